@@ -0,0 +1,342 @@
+package main
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+	"auth-service/internal/utils"
+	"auth-service/pkg/database"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Использование: authctl <команда> [аргументы]
+
+Ключи подписи JWT:
+  keys list                          список ключей и их статусов
+  keys generate [-alg RS256] [-promote]
+                                     новый ключ (по умолчанию только для проверки)
+  keys promote <kid>                 сделать ключ активным, прежний остается для проверки
+  keys retire <kid>                  вывести ключ из оборота, его токены перестанут приниматься
+
+Очередь писем:
+  emails list [-status dead] [-limit 50]
+                                     последние письма и статус доставки
+
+Роли:
+  roles list                         роли и их права
+  roles assign <email> <role>        назначить роль, например первому администратору
+  roles revoke <email> <role>        снять роль
+
+Приложения OAuth:
+  clients list                       зарегистрированные приложения
+  clients create -name <название> [-client-id crm] [-public] [-redirect-uris a,b]
+                 [-grant-types a,b] [-scopes a,b] [-audiences a,b]
+                 [-access-ttl сек] [-refresh-ttl сек] [-introspect-all]
+                                     новое приложение, секрет выводится один раз
+
+Секреты в базе:
+  secrets hash-legacy                захешировать refresh токены, токены сброса и коды,
+                                     отмеченные миграцией 023 как открытые, и наложить
+                                     ключ на хеши кодов восстановления (миграция 024)
+  secrets encrypt-totp               зашифровать секреты TOTP, сохраненные в открытом виде
+  secrets encrypt-signing-keys       зашифровать приватные ключи подписи, сохраненные открытым PEM
+`
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("⚠️  .env файл не найден, используются переменные окружения по умолчанию")
+	}
+
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	db, err := database.NewPostgresDB(cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName)
+	if err != nil {
+		log.Fatal("❌ Ошибка подключения к базе данных:", err)
+	}
+
+	switch os.Args[1] {
+	case "keys":
+		err = runKeys(service.NewKeyService(repository.NewKeyRepository(db)), os.Args[2], os.Args[3:])
+	case "emails":
+		err = runEmails(repository.NewOutboxRepository(db), os.Args[2], os.Args[3:])
+	case "roles":
+		err = runRoles(repository.NewUserRepository(db), os.Args[2], os.Args[3:])
+	case "clients":
+		err = runClients(repository.NewUserRepository(db), os.Args[2], os.Args[3:])
+	case "secrets":
+		err = runSecrets(repository.NewUserRepository(db), repository.NewKeyRepository(db), os.Args[2])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+}
+
+func runKeys(keyService *service.KeyService, command string, args []string) error {
+	switch command {
+	case "list":
+		keys, err := keyService.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KID\tALG\tSTATUS\tCREATED\tACTIVATED\tRETIRED")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.KID, key.Algorithm, key.Status, key.CreatedAt.Format("2006-01-02 15:04"),
+				formatTime(key.ActivatedAt), formatTime(key.RetiredAt))
+		}
+		return w.Flush()
+
+	case "generate":
+		fs := flag.NewFlagSet("keys generate", flag.ExitOnError)
+		alg := fs.String("alg", "RS256", "алгоритм: RS256, ES256 или EdDSA")
+		promote := fs.Bool("promote", false, "сразу сделать ключ активным")
+		fs.Parse(args)
+
+		key, err := keyService.Generate(*alg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Создан ключ %s (%s)\n", key.KID, key.Algorithm)
+
+		if *promote {
+			if err := keyService.Promote(key.KID); err != nil {
+				return err
+			}
+			fmt.Printf("✅ Ключ %s активирован\n", key.KID)
+		}
+		return nil
+
+	case "promote":
+		if len(args) != 1 {
+			return fmt.Errorf("укажите kid")
+		}
+		if err := keyService.Promote(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Ключ %s активирован\n", args[0])
+		return nil
+
+	case "retire":
+		if len(args) != 1 {
+			return fmt.Errorf("укажите kid")
+		}
+		if err := keyService.Retire(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Ключ %s выведен из оборота\n", args[0])
+		return nil
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	return nil
+}
+
+func runEmails(outboxRepo *repository.OutboxRepository, command string, args []string) error {
+	if command != "list" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("emails list", flag.ExitOnError)
+	status := fs.String("status", "", "pending, sent или dead")
+	limit := fs.Int("limit", 50, "сколько писем показать")
+	fs.Parse(args)
+
+	emails, err := outboxRepo.ListEmails(*status, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tRECIPIENT\tSTATUS\tATTEMPTS\tCREATED\tSENT\tLAST ERROR")
+	for _, email := range emails {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			email.ID, email.Recipient, email.Status, email.Attempts,
+			email.CreatedAt.Format("2006-01-02 15:04"), formatTime(email.SentAt), email.LastError)
+	}
+	return w.Flush()
+}
+
+func runRoles(userRepo *repository.UserRepository, command string, args []string) error {
+	if command == "list" {
+		roles, err := userRepo.ListRoles()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ROLE\tSYSTEM\tPERMISSIONS\tDESCRIPTION")
+		for _, role := range roles {
+			permissions := make([]string, len(role.Permissions))
+			for i, permission := range role.Permissions {
+				permissions[i] = permission.Name
+			}
+			fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", role.Name, role.System, strings.Join(permissions, ","), role.Description)
+		}
+		return w.Flush()
+	}
+
+	if (command != "assign" && command != "revoke") || len(args) != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	user, err := userRepo.GetUserByEmail(args[0])
+	if err != nil {
+		return err
+	}
+	role, err := userRepo.GetRoleByName(args[1])
+	if err != nil {
+		return fmt.Errorf("роль %s не найдена", args[1])
+	}
+
+	if command == "assign" {
+		err = userRepo.AssignRole(user.ID, role.ID)
+	} else {
+		err = userRepo.RevokeRole(user.ID, role.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// ВЫДАННЫЕ ТОКЕНЫ СО СТАРЫМ НАБОРОМ ПРАВ ПЕРЕСТАЮТ РАБОТАТЬ
+	if err := userRepo.IncrementTokenVersion(user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("✅ %s: роль %s для %s\n", command, role.Name, user.Email)
+	return nil
+}
+
+func runClients(userRepo *repository.UserRepository, command string, args []string) error {
+	switch command {
+	case "list":
+		clients, err := userRepo.ListOAuthClients()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT_ID\tNAME\tPUBLIC\tGRANT TYPES\tSCOPES\tREDIRECT URIS")
+		for _, client := range clients {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\n",
+				client.ClientID, client.Name, client.Public, strings.Join(client.GrantTypes, ","),
+				strings.Join(client.Scopes, ","), strings.Join(client.RedirectURIs, ","))
+		}
+		return w.Flush()
+
+	case "create":
+		fs := flag.NewFlagSet("clients create", flag.ExitOnError)
+		var req models.CreateOAuthClientRequest
+		fs.StringVar(&req.Name, "name", "", "название приложения")
+		fs.StringVar(&req.ClientID, "client-id", "", "client_id (по умолчанию генерируется)")
+		fs.BoolVar(&req.Public, "public", false, "публичный клиент без секрета (SPA, мобильное приложение)")
+		redirectURIs := fs.String("redirect-uris", "", "разрешенные redirect_uri через запятую")
+		grantTypes := fs.String("grant-types", "", "grant_type через запятую: authorization_code, refresh_token, client_credentials (по умолчанию authorization_code,refresh_token)")
+		scopes := fs.String("scopes", "", "разрешенные scope через запятую (по умолчанию openid,profile,email)")
+		audiences := fs.String("audiences", "", "aud access токенов через запятую (по умолчанию client_id)")
+		fs.IntVar(&req.AccessTokenTTL, "access-ttl", 0, "время жизни access token в секундах")
+		fs.IntVar(&req.RefreshTokenTTL, "refresh-ttl", 0, "время жизни refresh token в секундах")
+		fs.BoolVar(&req.IntrospectAll, "introspect-all", false, "интроспекция любых access токенов, в том числе самого сервиса (для шлюза)")
+		fs.Parse(args)
+
+		req.RedirectURIs = splitList(*redirectURIs)
+		req.GrantTypes = splitList(*grantTypes)
+		req.Scopes = splitList(*scopes)
+		req.Audiences = splitList(*audiences)
+
+		client, secret, err := service.NewOAuthClient(&req)
+		if err != nil {
+			return err
+		}
+		if _, err := userRepo.GetOAuthClient(client.ClientID); err == nil {
+			return fmt.Errorf("приложение %s уже существует", client.ClientID)
+		}
+		if err := userRepo.CreateOAuthClient(client); err != nil {
+			return err
+		}
+
+		fmt.Printf("✅ Создано приложение %s\n", client.Name)
+		fmt.Printf("client_id:     %s\n", client.ClientID)
+		if secret != "" {
+			fmt.Printf("client_secret: %s\n", secret)
+			fmt.Println("Сохраните секрет, повторно он не показывается")
+		}
+		return nil
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func runSecrets(userRepo *repository.UserRepository, keyRepo *repository.KeyRepository, command string) error {
+	switch command {
+	case "hash-legacy":
+		if err := utils.CheckTokenHashKey(); err != nil {
+			return err
+		}
+
+		updated, err := userRepo.HashLegacySecrets(utils.HashToken)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Захешировано записей: %d\n", updated)
+	case "encrypt-totp":
+		if err := utils.CheckTOTPEncryptionKey(); err != nil {
+			return err
+		}
+
+		updated, err := userRepo.EncryptLegacyTOTPSecrets(utils.EncryptTOTPSecret)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Зашифровано секретов TOTP: %d\n", updated)
+	case "encrypt-signing-keys":
+		if err := utils.CheckSigningKeyEncryptionKey(); err != nil {
+			return err
+		}
+
+		updated, err := keyRepo.EncryptLegacySigningKeys(utils.EncryptSigningKeyPEM)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Зашифровано ключей подписи: %d\n", updated)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -3,13 +3,18 @@ package main
 import (
 	"auth-service/internal/config"
 	"auth-service/internal/handlers"
+	"auth-service/internal/mailer"
 	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/ratelimit"
 	"auth-service/internal/repository"
 	"auth-service/internal/service"
+	"auth-service/internal/utils"
 	"auth-service/pkg/database"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -21,6 +26,21 @@ func main() {
 	}
 
 	cfg := config.Load()
+	if err := utils.CheckTokenHashKey(); err != nil {
+		log.Fatal("❌ Ошибка конфигурации: ", err)
+	}
+	if err := utils.CheckTOTPEncryptionKey(); err != nil {
+		log.Fatal("❌ Ошибка конфигурации: ", err)
+	}
+	if err := utils.CheckSigningKeyEncryptionKey(); err != nil {
+		log.Fatal("❌ Ошибка конфигурации: ", err)
+	}
+	if err := utils.CheckEmailEncryptionKey(); err != nil {
+		log.Fatal("❌ Ошибка конфигурации: ", err)
+	}
+	if os.Getenv("JWT_LEGACY_HS256_UNTIL") != "" {
+		log.Println("⚠️  JWT_LEGACY_HS256_UNTIL больше не поддерживается: токены без kid не принимаются")
+	}
 	log.Printf("📁 Конфигурация загружена: БД=%s, Порт=%s", cfg.DBName, cfg.Port)
 
 	db, err := database.NewPostgresDB(
@@ -34,12 +54,59 @@ func main() {
 		log.Fatal("❌ Ошибка подключения к базе данных:", err)
 	}
 
+	keyService := service.NewKeyService(repository.NewKeyRepository(db))
+	if err := keyService.Init(); err != nil {
+		log.Fatal("❌ Ошибка загрузки ключей подписи JWT:", err)
+	}
+	keyService.StartAutoReload(time.Duration(cfg.JWTKeysReloadSeconds) * time.Second)
+	signingKey := utils.CurrentKeyRing().Active()
+	log.Printf("🔑 JWT подписываются %s, kid=%s", signingKey.Algorithm, signingKey.ID)
+
 	userRepo := repository.NewUserRepository(db)
-	authService := service.NewAuthService(userRepo)
+	emailMailer, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal("❌ Ошибка настройки отправки писем:", err)
+	}
+	service.NewOutboxWorker(repository.NewOutboxRepository(db), emailMailer).Start()
+
+	renderer, err := mailer.NewRendererFromEnv()
+	if err != nil {
+		log.Fatal("❌ Ошибка загрузки шаблонов писем:", err)
+	}
+	webAuthn, err := service.NewWebAuthnFromEnv()
+	if err != nil {
+		log.Printf("⚠️ WebAuthn отключен, ошибка конфигурации: %v", err)
+	}
+	authService := service.NewAuthService(userRepo, renderer, webAuthn)
+	service.NewAccountPurgeWorker(authService).Start()
+
 	authHandler := handlers.NewAuthHandler(authService)
 
 	router := gin.Default()
 
+	// БЕЗ ЭТОГО gin ВЕРИТ X-Forwarded-For ОТ ЛЮБОГО КЛИЕНТА И ЛИМИТЫ ПО IP ОБХОДЯТСЯ
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("❌ Неверный TRUSTED_PROXIES:", err)
+	}
+	if len(cfg.TrustedProxies) == 0 {
+		log.Println("⚠️ TRUSTED_PROXIES не задан: за прокси все клиенты получат его адрес и общие лимиты и блокировку по IP")
+	}
+
+	var rateLimitStore ratelimit.Store
+	switch cfg.RateLimitBackend {
+	case "postgres":
+		rateLimitStore = ratelimit.NewPostgresStore(db)
+	case "memory":
+		rateLimitStore = ratelimit.NewMemoryStore()
+	default:
+		log.Fatal("❌ Неизвестный RATE_LIMIT_BACKEND: ", cfg.RateLimitBackend)
+	}
+	rateLimit := func(name, accountField, ipDefault, accountDefault string) gin.HandlerFunc {
+		return middleware.RateLimit(rateLimitStore, middleware.RateLimitRuleFromEnv(name, accountField, ipDefault, accountDefault))
+	}
+
+	router.Use(middleware.RequestID())
+
 	router.Use(func(c *gin.Context) {
 		allowedOrigins := strings.Split(os.Getenv("CORS_ALLOW_ORIGINS"), ",")
 		origin := c.Request.Header.Get("Origin")
@@ -48,8 +115,9 @@ func main() {
 			if origin == allowedOrigin {
 				c.Header("Access-Control-Allow-Origin", origin)
 				c.Header("Access-Control-Allow-Credentials", "true")
-				c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-				c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+				c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+				c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+				c.Header("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Request-ID")
 				break
 			}
 		}
@@ -67,19 +135,102 @@ func main() {
 
 	auth := router.Group("/auth")
 	{
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/login", authHandler.Login)
-		auth.POST("/verify-email", authHandler.VerifyEmail)
-		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/register", rateLimit("register", "email", "10/1h", "3/1h"), authHandler.Register)
+		auth.POST("/login", rateLimit("login", "email", "20/1m", "10/15m"), authHandler.Login)
+		auth.POST("/verify-email", rateLimit("verify-email", "activated_link", "20/1m", "5/10m"), authHandler.VerifyEmail)
+		auth.POST("/refresh", rateLimit("refresh", "", "60/1m", "0"), authHandler.Refresh)
 		auth.POST("/logout", authHandler.Logout)
-		auth.POST("/request-reset-password", authHandler.RequestResetPassword)
-		auth.POST("/reset-password", authHandler.ResetPassword)
+		auth.POST("/request-reset-password", rateLimit("request-reset-password", "email", "10/1h", "3/1h"), authHandler.RequestResetPassword)
+		auth.POST("/reset-password", rateLimit("reset-password", "", "20/1m", "0"), authHandler.ResetPassword)
+		auth.POST("/unlock", rateLimit("unlock", "", "10/1m", "0"), authHandler.UnlockAccount)
+		auth.POST("/email/undo", rateLimit("email-undo", "", "10/1m", "0"), authHandler.UndoEmailChange)
+		auth.POST("/account/restore", rateLimit("account-restore", "", "10/1m", "0"), authHandler.RestoreAccount)
+		auth.POST("/webauthn/login/begin", rateLimit("webauthn-login-begin", "", "30/1m", "0"), authHandler.BeginWebAuthnLogin)
+		auth.POST("/webauthn/login/finish", rateLimit("webauthn-login-finish", "", "20/1m", "0"), authHandler.FinishWebAuthnLogin)
 	}
 
 	protected := router.Group("/auth")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(authService), middleware.RequireFirstParty(), middleware.RequireSubjectType(utils.SubjectUser))
 	{
 		protected.GET("/profile", authHandler.Profile)
+		protected.PATCH("/profile", authHandler.UpdateProfile)
+		protected.POST("/password", rateLimit("password-change", "", "10/1m", "5/15m"), authHandler.ChangePassword)
+		protected.POST("/email", rateLimit("email-change", "new_email", "10/1h", "3/1h"), authHandler.RequestEmailChange)
+		protected.POST("/email/confirm", rateLimit("email-confirm", "activated_link", "20/1m", "5/10m"), authHandler.ConfirmEmailChange)
+		protected.GET("/account/export", authHandler.ExportAccount)
+		protected.POST("/account/delete", rateLimit("account-delete", "", "10/1h", "0"), authHandler.RequestAccountDeletion)
+		protected.POST("/account/delete/confirm", rateLimit("account-delete-confirm", "activated_link", "20/1m", "5/10m"), authHandler.ConfirmAccountDeletion)
+		protected.POST("/2fa/totp/enroll", rateLimit("totp-enroll", "", "10/1m", "10/1h"), authHandler.EnrollTOTP)
+		protected.POST("/2fa/totp/confirm", rateLimit("totp-confirm", "", "20/1m", "5/5m"), authHandler.ConfirmTOTP)
+		protected.POST("/2fa/totp/disable", rateLimit("totp-disable", "", "20/1m", "5/5m"), authHandler.DisableTOTP)
+		protected.POST("/2fa/recovery-codes", rateLimit("recovery-codes", "", "10/1m", "5/15m"), authHandler.RegenerateRecoveryCodes)
+		protected.POST("/webauthn/register/begin", authHandler.BeginWebAuthnRegistration)
+		protected.POST("/webauthn/register/finish", authHandler.FinishWebAuthnRegistration)
+		protected.GET("/webauthn/credentials", authHandler.ListWebAuthnCredentials)
+		protected.DELETE("/webauthn/credentials/:id", authHandler.DeleteWebAuthnCredential)
+		protected.GET("/sessions", authHandler.ListSessions)
+		protected.DELETE("/sessions/:id", authHandler.RevokeSession)
+		protected.POST("/sessions/revoke-others", authHandler.RevokeOtherSessions)
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(authService), middleware.RequireFirstParty(), middleware.RequireSubjectType(utils.SubjectUser))
+	{
+		admin.POST("/users/:id/unlock", middleware.RequirePermission(models.PermUsersUnlock), authHandler.AdminUnlockUser)
+		admin.GET("/auth-events", middleware.RequirePermission(models.PermAuditRead), authHandler.ListAuthEvents)
+	}
+
+	users := admin.Group("/users")
+	{
+		users.GET("", middleware.RequirePermission(models.PermUsersRead), authHandler.ListUsers)
+		users.GET("/:id", middleware.RequirePermission(models.PermUsersRead), authHandler.GetUser)
+		users.GET("/:id/export", middleware.RequirePermission(models.PermUsersRead), authHandler.ExportUser)
+		users.PATCH("/:id", middleware.RequirePermission(models.PermUsersWrite), authHandler.UpdateUser)
+		users.POST("/:id/disable", middleware.RequirePermission(models.PermUsersWrite), authHandler.DisableUser)
+		users.POST("/:id/enable", middleware.RequirePermission(models.PermUsersWrite), authHandler.EnableUser)
+		users.POST("/:id/force-password-reset", middleware.RequirePermission(models.PermUsersWrite), authHandler.ForcePasswordReset)
+		users.POST("/:id/reset-2fa", middleware.RequirePermission(models.PermUsersWrite), authHandler.ResetUserTwoFactor)
+		users.POST("/:id/revoke-sessions", middleware.RequirePermission(models.PermUsersWrite), authHandler.RevokeUserSessions)
+		users.DELETE("/:id", middleware.RequirePermission(models.PermUsersWrite), authHandler.DeleteUser)
+		users.POST("/:id/restore", middleware.RequirePermission(models.PermUsersWrite), authHandler.RestoreUser)
+	}
+
+	roles := admin.Group("")
+	roles.Use(middleware.RequirePermission(models.PermRolesManage))
+	{
+		roles.GET("/permissions", authHandler.ListPermissions)
+		roles.GET("/roles", authHandler.ListRoles)
+		roles.POST("/roles", authHandler.CreateRole)
+		roles.PUT("/roles/:name", authHandler.UpdateRole)
+		roles.DELETE("/roles/:name", authHandler.DeleteRole)
+		roles.GET("/users/:id/roles", authHandler.GetUserRoles)
+		roles.POST("/users/:id/roles", authHandler.AssignRole)
+		roles.DELETE("/users/:id/roles/:role", authHandler.RevokeRole)
+	}
+
+	clients := admin.Group("/clients")
+	clients.Use(middleware.RequirePermission(models.PermClientsManage))
+	{
+		clients.GET("", authHandler.ListOAuthClients)
+		clients.POST("", authHandler.CreateOAuthClient)
+		clients.GET("/:client_id", authHandler.GetOAuthClient)
+		clients.PUT("/:client_id", authHandler.UpdateOAuthClient)
+		clients.DELETE("/:client_id", authHandler.DeleteOAuthClient)
+		clients.POST("/:client_id/secret", authHandler.RotateOAuthClientSecret)
+	}
+
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	router.GET("/.well-known/openid-configuration", authHandler.OpenIDConfiguration)
+
+	oauth := router.Group("/oauth")
+	{
+		oauth.GET("/authorize", authHandler.Authorize)
+		oauth.GET("/authorization-requests/:id", authHandler.GetAuthorizationRequest)
+		oauth.POST("/token", rateLimit("oauth-token", "", "60/1m", "0"), authHandler.Token)
+		oauth.POST("/introspect", rateLimit("oauth-introspect", "", "300/1m", "0"), authHandler.Introspect)
+		oauth.POST("/revoke", rateLimit("oauth-revoke", "", "60/1m", "0"), authHandler.Revoke)
+		oauth.GET("/userinfo", middleware.AuthMiddleware(authService), middleware.RequireSubjectType(utils.SubjectUser), middleware.RequireScope("openid"), authHandler.UserInfo)
+		oauth.POST("/userinfo", middleware.AuthMiddleware(authService), middleware.RequireSubjectType(utils.SubjectUser), middleware.RequireScope("openid"), authHandler.UserInfo)
 	}
 
 	router.GET("/health", func(c *gin.Context) {
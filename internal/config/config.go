@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -13,6 +14,11 @@ type Config struct {
 	DBName     string
 	Port       string
 	JWTSecret  string
+
+	JWTKeysReloadSeconds int
+
+	RateLimitBackend string   // memory или postgres
+	TrustedProxies   []string // адреса прокси, которым можно верить в X-Forwarded-For
 }
 
 func Load() *Config {
@@ -24,6 +30,11 @@ func Load() *Config {
 		DBName:     getEnv("DB_NAME", "auth_service"),
 		Port:       getEnv("PORT", "8080"),
 		JWTSecret:  getEnv("JWT_SECRET", ""),
+
+		JWTKeysReloadSeconds: getEnvAsInt("JWT_KEYS_RELOAD_SECONDS", 60),
+
+		RateLimitBackend: getEnv("RATE_LIMIT_BACKEND", "memory"),
+		TrustedProxies:   getEnvAsList("TRUSTED_PROXIES"),
 	}
 }
 
@@ -42,3 +53,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	user, err := h.authService.UpdateProfile(userID, &req, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ProfileResponse{
+		ID:       user.ID,
+		Name:     user.Name,
+		Lastname: user.Lastname,
+		Email:    user.Email,
+		Roles:    user.Roles,
+	})
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	if err := h.authService.ChangePassword(userID, c.GetString("session_id"), &req, clientInfo(c)); err != nil {
+		c.JSON(accountErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пароль изменен, остальные сессии завершены"})
+}
+
+func (h *AuthHandler) RequestEmailChange(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	response, err := h.authService.RequestEmailChange(userID, &req, clientInfo(c))
+	if err != nil {
+		c.JSON(accountErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	var req models.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	user, err := h.authService.ConfirmEmailChange(userID, &req, clientInfo(c))
+	if err != nil {
+		c.JSON(accountErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email изменен, обновите токены",
+		"email":   user.Email,
+	})
+}
+
+func (h *AuthHandler) UndoEmailChange(c *gin.Context) {
+	var req models.UndoEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	if err := h.authService.UndoEmailChange(&req, clientInfo(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Прежний email восстановлен, ссылка для смены пароля отправлена на него"})
+}
+
+func (h *AuthHandler) RequestAccountDeletion(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	response, err := h.authService.RequestAccountDeletion(userID, req.Password, clientInfo(c))
+	if err != nil {
+		c.JSON(accountErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AuthHandler) ConfirmAccountDeletion(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	var req models.ConfirmAccountDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	purgeAt, err := h.authService.ConfirmAccountDeletion(userID, &req, clientInfo(c))
+	if err != nil {
+		c.JSON(accountErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.clearTokenCookies(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Аккаунт удален, до указанного времени его можно восстановить по ссылке из письма",
+		"deletion_scheduled_at": purgeAt,
+	})
+}
+
+func (h *AuthHandler) RestoreAccount(c *gin.Context) {
+	var req models.RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	if err := h.authService.RestoreAccount(&req, clientInfo(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Аккаунт восстановлен, можно войти"})
+}
+
+func (h *AuthHandler) ExportAccount(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	h.sendAccountExport(c, userID)
+}
+
+// архив отдается файлом, чтобы браузер сохранил его, а не показал
+func (h *AuthHandler) sendAccountExport(c *gin.Context, userID uint) {
+	export, err := h.authService.ExportAccount(userID)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d-%s.json"`, userID, export.ExportedAt.Format("20060102-150405")))
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, export)
+}
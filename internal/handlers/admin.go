@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// id пользователя из пути, при ошибке ответ уже отправлен
+func userIDParam(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор пользователя"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+func (h *AuthHandler) AdminUnlockUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.AdminUnlockUser(userID, clientInfo(c)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пользователь разблокирован"})
+}
+
+// GET /admin/auth-events?user_id=&actor_id=&type=login,logout&outcome=&from=&to=&cursor=&limit=&format=json|csv
+// json - страница и next_cursor, csv - выгрузка всех событий по фильтру
+func (h *AuthHandler) ListAuthEvents(c *gin.Context) {
+	filter, err := authEventFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		events, next, err := h.authService.ListAuthEvents(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		body := gin.H{"events": events, "next_cursor": nil}
+		if next > 0 {
+			body["next_cursor"] = strconv.FormatUint(next, 10)
+		}
+		c.JSON(http.StatusOK, body)
+	case "csv":
+		h.exportAuthEventsCSV(c, filter)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр format: json или csv"})
+	}
+}
+
+// выгрузка идет страницами по курсору, чтобы не держать весь журнал в памяти
+func (h *AuthHandler) exportAuthEventsCSV(c *gin.Context, filter *models.AuthEventFilter) {
+	filter.Limit = 1000
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="auth_events.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "created_at", "type", "outcome", "actor_id", "user_id", "ip", "user_agent", "correlation_id", "details"})
+
+	for {
+		events, next, err := h.authService.ListAuthEvents(filter)
+		if err != nil {
+			// ЗАГОЛОВКИ УЖЕ ОТПРАВЛЕНЫ, ОБРЫВАЕМ ФАЙЛ ЯВНОЙ СТРОКОЙ
+			writer.Write([]string{"error", csvCell(err.Error())})
+			break
+		}
+
+		for _, event := range events {
+			writer.Write([]string{
+				strconv.FormatUint(event.ID, 10),
+				event.CreatedAt.UTC().Format(time.RFC3339),
+				csvCell(event.Type),
+				csvCell(event.Outcome),
+				optionalID(event.ActorID),
+				optionalID(event.UserID),
+				csvCell(event.IP),
+				csvCell(event.UserAgent),
+				csvCell(event.CorrelationID),
+				csvCell(event.Details),
+			})
+		}
+		writer.Flush()
+
+		if next == 0 {
+			break
+		}
+		filter.Before = next
+	}
+
+	writer.Flush()
+}
+
+// user agent и details приходят от клиента: значение, которое Excel или Sheets примут за формулу,
+// начинаем с апострофа
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func authEventFilter(c *gin.Context) (*models.AuthEventFilter, error) {
+	filter := &models.AuthEventFilter{
+		Outcome: c.Query("outcome"),
+	}
+
+	var err error
+	if filter.UserID, err = queryID(c, "user_id"); err != nil {
+		return nil, err
+	}
+	if filter.ActorID, err = queryID(c, "actor_id"); err != nil {
+		return nil, err
+	}
+	if filter.From, err = queryTime(c, "from"); err != nil {
+		return nil, err
+	}
+	if filter.To, err = queryTime(c, "to"); err != nil {
+		return nil, err
+	}
+
+	if types := c.Query("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				filter.Types = append(filter.Types, eventType)
+			}
+		}
+	}
+
+	if filter.Outcome != "" && filter.Outcome != "success" && filter.Outcome != "failure" {
+		return nil, errInvalidQuery("outcome")
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if filter.Before, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, errInvalidQuery("cursor")
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			return nil, errInvalidQuery("limit")
+		}
+	}
+
+	return filter, nil
+}
+
+func queryID(c *gin.Context, name string) (*uint, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, errInvalidQuery(name)
+	}
+	id := uint(parsed)
+	return &id, nil
+}
+
+// время в RFC3339, например 2024-01-01T00:00:00Z
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errInvalidQuery(name)
+	}
+	return &parsed, nil
+}
+
+func optionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+func errInvalidQuery(name string) error {
+	return fmt.Errorf("неверный параметр %s", name)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /admin/users?q=&role=&status=active|disabled|locked|deleted&two_factor=email|totp&cursor=&limit=
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	filter := &models.UserFilter{
+		Query:     c.Query("q"),
+		Role:      c.Query("role"),
+		Status:    c.Query("status"),
+		TwoFactor: c.Query("two_factor"),
+	}
+
+	switch filter.Status {
+	case "", "active", "disabled", "locked", "deleted":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр status: active, disabled, locked или deleted"})
+		return
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidQuery("cursor").Error()})
+			return
+		}
+		filter.After = uint(after)
+	}
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidQuery("limit").Error()})
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	users, next, total, err := h.authService.ListUsers(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := gin.H{"users": users, "total": total, "next_cursor": nil}
+	if next > 0 {
+		body["next_cursor"] = strconv.FormatUint(uint64(next), 10)
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func (h *AuthHandler) GetUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	details, err := h.authService.GetUserDetails(userID)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, details)
+}
+
+func (h *AuthHandler) UpdateUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.AdminUpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	// НАЗНАЧАТЬ РОЛИ МОЖЕТ ТОЛЬКО ТОТ, КТО УПРАВЛЯЕТ РОЛЯМИ, ИНАЧЕ users:write ДАЕТ ЛЮБЫЕ ПРАВА
+	if req.Roles != nil && !hasPermission(c, models.PermRolesManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Для изменения ролей нужно право roles:manage"})
+		return
+	}
+
+	user, err := h.authService.AdminUpdateUser(userID, &req, clientInfo(c))
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *AuthHandler) DisableUser(c *gin.Context) {
+	h.adminUserAction(c, h.authService.DisableUser, "Аккаунт отключен, сессии завершены")
+}
+
+func (h *AuthHandler) EnableUser(c *gin.Context) {
+	h.adminUserAction(c, h.authService.EnableUser, "Аккаунт включен")
+}
+
+func (h *AuthHandler) ForcePasswordReset(c *gin.Context) {
+	h.adminUserAction(c, h.authService.ForcePasswordReset, "Сессии завершены, ссылка для сброса пароля отправлена")
+}
+
+func (h *AuthHandler) ResetUserTwoFactor(c *gin.Context) {
+	h.adminUserAction(c, h.authService.AdminResetTwoFactor, "2FA сброшена")
+}
+
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	h.adminUserAction(c, h.authService.AdminRevokeSessions, "Все сессии пользователя завершены")
+}
+
+func (h *AuthHandler) DeleteUser(c *gin.Context) {
+	h.adminUserAction(c, h.authService.AdminDeleteUser, "Аккаунт удален, сессии завершены, пользователю отправлена ссылка восстановления")
+}
+
+func (h *AuthHandler) RestoreUser(c *gin.Context) {
+	h.adminUserAction(c, h.authService.AdminRestoreUser, "Аккаунт восстановлен")
+}
+
+func (h *AuthHandler) ExportUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	h.sendAccountExport(c, userID)
+}
+
+// общий вид действий над пользователем без тела запроса
+func (h *AuthHandler) adminUserAction(c *gin.Context, action func(uint, *models.ClientInfo) error, message string) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := action(userID, clientInfo(c)); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func hasPermission(c *gin.Context, permission string) bool {
+	for _, granted := range c.GetStringSlice("user_permissions") {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func userErrorStatus(err error) int {
+	if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrRoleNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -4,6 +4,7 @@ import (
 	"auth-service/internal/models"
 	"auth-service/internal/service"
 	"auth-service/internal/utils"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -46,6 +47,47 @@ func (h *AuthHandler) clearTokenCookies(c *gin.Context) {
 	c.SetCookie("refresh_token", "", -1, "/auth/refresh", "", true, true)
 }
 
+func currentUserID(c *gin.Context) (uint, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	id, ok := userID.(uint)
+	return id, ok
+}
+
+// данные об устройстве для списка сессий, название клиента приходит в X-Client-Label
+func clientInfo(c *gin.Context) *models.ClientInfo {
+	client := &models.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		Label:     c.GetHeader("X-Client-Label"),
+		// язык писем, если пользователь его не выбрал
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		RequestID:      c.GetString("request_id"),
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		client.ActorID, _ = userID.(uint)
+	}
+	return client
+}
+
+// статус для ошибок состояния аккаунта, остальные ошибки получают fallback
+func accountErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, service.ErrAccountLocked):
+		return http.StatusLocked
+	case errors.Is(err, service.ErrTooManyLoginAttempts):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrAccountDisabled), errors.Is(err, service.ErrPasswordResetRequired),
+		errors.Is(err, service.ErrAccountDeletionScheduled):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrAuthorizationRequestExpired):
+		return http.StatusBadRequest
+	}
+	return fallback
+}
+
 func (h *AuthHandler) Register(c *gin.Context) {
 	fmt.Println("🎯 ДЕБАГ: ===== REGISTER HANDLER START =====")
 
@@ -60,7 +102,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	fmt.Printf("📧 ДЕБАГ: Registering user: %s\n", registerReq.Email)
 
-	response, err := h.authService.Register(&registerReq)
+	response, err := h.authService.Register(&registerReq, clientInfo(c))
 	if err != nil {
 		fmt.Printf("❌ ДЕБАГ: Service error: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -88,9 +130,9 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.Login(&loginReq)
+	response, err := h.authService.Login(&loginReq, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		c.JSON(accountErrorStatus(err, http.StatusUnauthorized), gin.H{
 			"error": err.Error(),
 		})
 		return
@@ -106,15 +148,27 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.VerifyCode(&req)
+	response, err := h.authService.VerifyCode(&req, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(accountErrorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"access_token":  response.AccessToken,
-		"refresh_token": response.RefreshToken})
+		"refresh_token": response.RefreshToken,
+	}
+	if response.RedirectTo != "" {
+		body = gin.H{"redirect_to": response.RedirectTo}
+	}
+	if len(response.RecoveryCodes) > 0 {
+		body["recovery_codes"] = response.RecoveryCodes
+	}
+	if response.RecoveryCodesRemaining != nil {
+		body["recovery_codes_remaining"] = *response.RecoveryCodesRemaining
+	}
+
+	c.JSON(http.StatusOK, body)
 }
 
 func (h *AuthHandler) Profile(c *gin.Context) {
@@ -141,7 +195,7 @@ func (h *AuthHandler) Profile(c *gin.Context) {
 		Name:     user.Name,
 		Lastname: user.Lastname,
 		Email:    user.Email,
-		Role:     user.Role, // 👈 ДОБАВЬ ЭТУ СТРОКУ
+		Roles:    user.Roles,
 	}
 
 	c.JSON(http.StatusOK, profile)
@@ -160,9 +214,9 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.authService.RefreshTokens(refreshToken)
+	tokens, err := h.authService.RefreshTokens(refreshToken, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.JSON(accountErrorStatus(err, http.StatusUnauthorized), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -174,6 +228,39 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+			return
+		}
+	}
+
+	// REFRESH TOKEN ИЩЕМ В ЗАГОЛОВКЕ, ПОТОМ В COOKIE, ПОТОМ В ТЕЛЕ
+	refreshToken := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if refreshToken == "" {
+		refreshToken, _ = c.Cookie("refresh_token")
+	}
+	if refreshToken == "" {
+		refreshToken = req.RefreshToken
+	}
+
+	scope := req.Scope
+	if scope == "" {
+		scope = c.Query("scope")
+	}
+	allDevices := scope == "all"
+
+	if refreshToken != "" {
+		if err := h.authService.Logout(refreshToken, allDevices, clientInfo(c)); err != nil && allDevices {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+	} else if allDevices {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Отсутствует refresh token"})
+		return
+	}
+
 	c.SetSameSite(http.SameSiteNoneMode)
 
 	c.SetCookie(
@@ -196,8 +283,15 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		true,
 	)
 
+	h.clearTokenCookies(c)
+
+	message := "Успешный выход"
+	if allDevices {
+		message = "Выполнен выход на всех устройствах"
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Успешный выход",
+		"message": message,
 	})
 }
 
@@ -208,7 +302,7 @@ func (h *AuthHandler) RequestResetPassword(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.RequestResetPassword(&req)
+	response, err := h.authService.RequestResetPassword(&req, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -224,7 +318,7 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.ResetPassword(&req)
+	response, err := h.authService.ResetPassword(&req, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -233,6 +327,21 @@ func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	var req models.UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
+		return
+	}
+
+	if err := h.authService.UnlockAccount(req.Token, clientInfo(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Аккаунт разблокирован"})
+}
+
 func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		accessToken, err := c.Cookie("access_token")
@@ -257,3 +366,8 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.CurrentKeyRing().JWKS())
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/service"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *AuthHandler) OpenIDConfiguration(c *gin.Context) {
+	config, err := h.authService.OpenIDConfiguration()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, config)
+}
+
+// GET /oauth/authorize - браузер уходит на страницу входа или обратно в приложение с ошибкой
+func (h *AuthHandler) Authorize(c *gin.Context) {
+	var req models.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные параметры запроса"})
+		return
+	}
+
+	redirectTo, err := h.authService.Authorize(&req, clientInfo(c))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrOIDCNotConfigured) {
+			status = http.StatusNotFound
+		}
+		// ПРИЛОЖЕНИЕ НЕ ОПОЗНАНО - НА ЕГО redirect_uri НЕ ПЕРЕНАПРАВЛЯЕМ
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirectTo)
+}
+
+func (h *AuthHandler) GetAuthorizationRequest(c *gin.Context) {
+	info, err := h.authService.GetAuthorizationRequest(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// POST /oauth/token, тело application/x-www-form-urlencoded, ответы и ошибки по RFC 6749
+func (h *AuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req models.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: "неверные параметры запроса"})
+		return
+	}
+	if !bindClientCredentials(c, &req.ClientID, &req.ClientSecret) {
+		return
+	}
+
+	response, err := h.authService.ExchangeToken(&req, clientInfo(c))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AuthHandler) UserInfo(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	claims, err := h.authService.UserInfo(userID, c.GetString("token_scope"))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, claims)
+}
+
+// POST /oauth/introspect по RFC 7662, для неактивного токена - {"active": false}
+func (h *AuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var req models.IntrospectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: "неверные параметры запроса"})
+		return
+	}
+	if !bindClientCredentials(c, &req.ClientID, &req.ClientSecret) {
+		return
+	}
+
+	response, err := h.authService.IntrospectToken(&req)
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /oauth/revoke по RFC 7009: неизвестный или чужой токен тоже отвечает 200
+func (h *AuthHandler) Revoke(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var req models.RevokeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: "неверные параметры запроса"})
+		return
+	}
+	if !bindClientCredentials(c, &req.ClientID, &req.ClientSecret) {
+		return
+	}
+
+	if err := h.authService.RevokeToken(&req, clientInfo(c)); err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// client_secret_basic: id и секрет в Authorization, закодированы как form-urlencoded.
+// Иначе остаются client_id и client_secret из тела (client_secret_post)
+func bindClientCredentials(c *gin.Context, clientID, clientSecret *string) bool {
+	basicID, basicSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		return true
+	}
+
+	id, idErr := url.QueryUnescape(basicID)
+	secret, secretErr := url.QueryUnescape(basicSecret)
+	if idErr != nil || secretErr != nil || (*clientID != "" && *clientID != id) || *clientSecret != "" {
+		oauthError(c, &service.OAuthError{Code: "invalid_request", Description: "клиент аутентифицирован несколькими способами"})
+		return false
+	}
+	*clientID, *clientSecret = id, secret
+	return true
+}
+
+// ошибка в формате RFC 6749: error и error_description
+func oauthError(c *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		// ПРИЧИНА ТОЛЬКО В ЛОГ: ТЕКСТ ОШИБКИ БАЗЫ ИЛИ КЛЮЧЕЙ НЕ ДЛЯ ПРИЛОЖЕНИЙ
+		log.Printf("⚠️ Ошибка OAuth %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": "внутренняя ошибка сервера"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	case "insufficient_scope":
+		status = http.StatusForbidden
+	}
+	c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
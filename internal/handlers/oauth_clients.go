@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *AuthHandler) ListOAuthClients(c *gin.Context) {
+	clients, err := h.authService.ListOAuthClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки приложений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+func (h *AuthHandler) GetOAuthClient(c *gin.Context) {
+	client, err := h.authService.GetOAuthClient(c.Param("client_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+func (h *AuthHandler) CreateOAuthClient(c *gin.Context) {
+	var req models.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	response, err := h.authService.CreateOAuthClient(&req, clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *AuthHandler) UpdateOAuthClient(c *gin.Context) {
+	var req models.UpdateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	client, err := h.authService.UpdateOAuthClient(c.Param("client_id"), &req, clientInfo(c))
+	if err != nil {
+		c.JSON(oauthClientErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+func (h *AuthHandler) RotateOAuthClientSecret(c *gin.Context) {
+	response, err := h.authService.RotateOAuthClientSecret(c.Param("client_id"), clientInfo(c))
+	if err != nil {
+		c.JSON(oauthClientErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AuthHandler) DeleteOAuthClient(c *gin.Context) {
+	if err := h.authService.DeleteOAuthClient(c.Param("client_id"), clientInfo(c)); err != nil {
+		c.JSON(oauthClientErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Приложение удалено, его сессии завершены"})
+}
+
+func oauthClientErrorStatus(err error) int {
+	if errors.Is(err, service.ErrOAuthClientNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// для разработки: складывает письма в .eml файлы, их можно открыть любым почтовым клиентом
+type FileMailer struct {
+	dir  string
+	from Sender
+}
+
+func NewFileMailer(dir string, from Sender) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога для писем: %w", err)
+	}
+	if from.Email == "" {
+		from.Email = "no-reply@localhost"
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(msg *Message) error {
+	data, err := buildMIME(m.from, msg)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования письма: %w", err)
+	}
+
+	suffix, err := randomHex(4)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000"), suffix)
+	path := filepath.Join(m.dir, name)
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("ошибка записи письма: %w", err)
+	}
+
+	fmt.Printf("📁 [FILE] Письмо для %s сохранено в %s\n", msg.To, path)
+	return nil
+}
+
+// для разработки: печатает письмо в лог вместо отправки
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(msg *Message) error {
+	fmt.Printf("📧 [LOG] To: %s\n   Subject: %s\n%s\n", msg.To, msg.Subject, msg.Text)
+	return nil
+}
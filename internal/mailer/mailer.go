@@ -0,0 +1,143 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"strings"
+	"time"
+)
+
+// письмо в виде, не зависящем от способа доставки
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// способ доставки писем: Resend, SMTP, файлы или лог
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// отправитель писем
+type Sender struct {
+	Email string
+	Name  string
+}
+
+func (s Sender) String() string {
+	if s.Name == "" {
+		return s.Email
+	}
+	return mime.QEncoding.Encode("utf-8", s.Name) + " <" + s.Email + ">"
+}
+
+// EMAIL_TRANSPORT: resend, smtp, file или log.
+// по умолчанию resend, если задан RESEND_API_KEY, иначе log
+func NewFromEnv() (Mailer, error) {
+	sender := Sender{
+		Email: firstEnv("EMAIL_FROM", "RESEND_FROM_EMAIL"),
+		Name:  firstEnv("EMAIL_FROM_NAME", "RESEND_FROM_NAME"),
+	}
+	if sender.Name == "" {
+		sender.Name = "Auth Service"
+	}
+
+	transport := os.Getenv("EMAIL_TRANSPORT")
+	if transport == "" {
+		transport = "log"
+		if os.Getenv("RESEND_API_KEY") != "" {
+			transport = "resend"
+		}
+	}
+
+	switch transport {
+	case "resend":
+		return NewResendMailer(os.Getenv("RESEND_API_KEY"), sender)
+	case "smtp":
+		return NewSMTPMailerFromEnv(sender)
+	case "file":
+		dir := os.Getenv("EMAIL_FILE_DIR")
+		if dir == "" {
+			dir = "./tmp/emails"
+		}
+		return NewFileMailer(dir, sender)
+	case "log":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("неизвестный EMAIL_TRANSPORT: %s", transport)
+	}
+}
+
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// собирает письмо в формате RFC 5322 с текстовой и HTML частями
+func buildMIME(from Sender, msg *Message) ([]byte, error) {
+	boundary, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	messageID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from.Email, "@"); at >= 0 {
+		domain = from.Email[at+1:]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", messageID, domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	}
+	for _, part := range parts {
+		if part.body == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writer := quotedprintable.NewWriter(&buf)
+		if _, err := writer.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func randomHex(n int) (string, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
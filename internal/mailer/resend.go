@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const resendAPIURL = "https://api.resend.com/emails"
+
+type ResendMailer struct {
+	apiKey string
+	from   Sender
+	client *http.Client
+}
+
+func NewResendMailer(apiKey string, from Sender) (*ResendMailer, error) {
+	if apiKey == "" {
+		return nil, errors.New("RESEND_API_KEY не установлен")
+	}
+	if from.Email == "" {
+		return nil, errors.New("EMAIL_FROM (или RESEND_FROM_EMAIL) не установлен")
+	}
+
+	return &ResendMailer{
+		apiKey: apiKey,
+		from:   from,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Resend API структуры
+type resendEmailRequest struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Html    string   `json:"html"`
+	Text    string   `json:"text"`
+}
+
+type resendEmailResponse struct {
+	Id string `json:"id"`
+}
+
+func (m *ResendMailer) Send(msg *Message) error {
+	start := time.Now()
+
+	jsonData, err := json.Marshal(resendEmailRequest{
+		From:    m.from.Name + " <" + m.from.Email + ">",
+		To:      []string{msg.To},
+		Subject: msg.Subject,
+		Html:    msg.HTML,
+		Text:    msg.Text,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга JSON: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", resendAPIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка HTTP запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Resend error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var emailResp resendEmailResponse
+	_ = json.Unmarshal(body, &emailResp)
+	fmt.Printf("✅ [RESEND] Письмо отправлено на %s за %v, ID: %s\n", msg.To, time.Since(start), emailResp.Id)
+	return nil
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	security string // starttls, tls или none
+	from     Sender
+}
+
+// SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD и SMTP_SECURITY:
+// starttls (по умолчанию, порт 587), tls (сразу TLS, порт 465) или none
+func NewSMTPMailerFromEnv(from Sender) (*SMTPMailer, error) {
+	security := os.Getenv("SMTP_SECURITY")
+	if security == "" {
+		security = "starttls"
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+		if security == "tls" {
+			port = "465"
+		}
+	}
+
+	return NewSMTPMailer(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), security, from)
+}
+
+func NewSMTPMailer(host, port, username, password, security string, from Sender) (*SMTPMailer, error) {
+	if host == "" {
+		return nil, errors.New("SMTP_HOST не установлен")
+	}
+	if from.Email == "" {
+		return nil, errors.New("EMAIL_FROM не установлен")
+	}
+	switch security {
+	case "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("неизвестный SMTP_SECURITY: %s", security)
+	}
+
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		security: security,
+		from:     from,
+	}, nil
+}
+
+func (m *SMTPMailer) Send(msg *Message) error {
+	data, err := buildMIME(m.from, msg)
+	if err != nil {
+		return fmt.Errorf("ошибка формирования письма: %w", err)
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к SMTP: %w", err)
+	}
+	defer client.Close()
+
+	tlsConfig := &tls.Config{ServerName: m.host}
+	if m.security == "starttls" {
+		// БЕЗ STARTTLS ПАРОЛЬ УШЕЛ БЫ ОТКРЫТЫМ ТЕКСТОМ - НЕ ОТПРАВЛЯЕМ
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP сервер не поддерживает STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("ошибка STARTTLS: %w", err)
+		}
+	}
+
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("ошибка авторизации SMTP: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from.Email); err != nil {
+		return fmt.Errorf("ошибка MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("ошибка RCPT TO: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("ошибка DATA: %w", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("ошибка передачи письма: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("ошибка передачи письма: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	address := net.JoinHostPort(m.host, m.port)
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if m.security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,245 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// оформление писем конкретной инсталляции
+type Brand struct {
+	Name         string
+	Color        string
+	LogoURL      string
+	SupportEmail string
+}
+
+// собирает письма из шаблонов. Для письма name в каталоге локали лежат
+// name.subject.txt, name.txt и name.html (определяет блоки content и footer для layout.html).
+// Любой файл можно переопределить, положив его по тому же пути в EMAIL_TEMPLATES_DIR
+type Renderer struct {
+	fsys          fs.FS
+	brand         Brand
+	defaultLocale string
+	locales       []string
+	matcher       language.Matcher
+	matched       []string // локали в порядке тегов matcher
+
+	mu    sync.Mutex
+	cache map[string]*parsedTemplate
+}
+
+type parsedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// BRAND_NAME, BRAND_COLOR, BRAND_LOGO_URL, BRAND_SUPPORT_EMAIL,
+// EMAIL_TEMPLATES_DIR и EMAIL_DEFAULT_LOCALE (по умолчанию ru)
+func NewRendererFromEnv() (*Renderer, error) {
+	brand := Brand{
+		Name:         firstEnv("BRAND_NAME", "EMAIL_FROM_NAME", "RESEND_FROM_NAME"),
+		Color:        os.Getenv("BRAND_COLOR"),
+		LogoURL:      os.Getenv("BRAND_LOGO_URL"),
+		SupportEmail: os.Getenv("BRAND_SUPPORT_EMAIL"),
+	}
+	if brand.Name == "" {
+		brand.Name = "Auth Service"
+	}
+	if brand.Color == "" {
+		brand.Color = "#1890ff"
+	}
+
+	defaultLocale := os.Getenv("EMAIL_DEFAULT_LOCALE")
+	if defaultLocale == "" {
+		defaultLocale = "ru"
+	}
+
+	return NewRenderer(os.Getenv("EMAIL_TEMPLATES_DIR"), brand, defaultLocale)
+}
+
+func NewRenderer(overrideDir string, brand Brand, defaultLocale string) (*Renderer, error) {
+	base, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	layers := []fs.FS{base}
+	if overrideDir != "" {
+		info, err := os.Stat(overrideDir)
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("EMAIL_TEMPLATES_DIR не найден: %s", overrideDir)
+		}
+		layers = append([]fs.FS{os.DirFS(overrideDir)}, layers...)
+	}
+
+	// локаль - это каталог верхнего уровня в любом из слоев
+	seen := map[string]bool{}
+	var locales []string
+	for _, layer := range layers {
+		entries, err := fs.ReadDir(layer, ".")
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения шаблонов писем: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				locales = append(locales, entry.Name())
+			}
+		}
+	}
+	sort.Strings(locales)
+
+	if !seen[defaultLocale] {
+		return nil, fmt.Errorf("нет шаблонов писем для локали по умолчанию %s", defaultLocale)
+	}
+
+	// локаль по умолчанию первой - ее matcher выбирает, когда ничего не совпало
+	matched := []string{defaultLocale}
+	for _, locale := range locales {
+		if locale != defaultLocale {
+			matched = append(matched, locale)
+		}
+	}
+	tags := make([]language.Tag, len(matched))
+	for i, locale := range matched {
+		tags[i] = language.Make(locale)
+	}
+
+	return &Renderer{
+		fsys:          overlayFS(layers),
+		brand:         brand,
+		defaultLocale: defaultLocale,
+		locales:       locales,
+		matcher:       language.NewMatcher(tags),
+		matched:       matched,
+		cache:         map[string]*parsedTemplate{},
+	}, nil
+}
+
+// выбирает локаль: сохраненная у пользователя, затем Accept-Language, затем локаль по умолчанию
+func (r *Renderer) Locale(preferred, acceptLanguage string) string {
+	if r.Supports(preferred) {
+		return preferred
+	}
+
+	if acceptLanguage != "" {
+		tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+		if err == nil && len(tags) > 0 {
+			_, index, confidence := r.matcher.Match(tags...)
+			if confidence != language.No {
+				return r.matched[index]
+			}
+		}
+	}
+
+	return r.defaultLocale
+}
+
+func (r *Renderer) Supports(locale string) bool {
+	for _, supported := range r.locales {
+		if supported == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// собирает письмо name на языке locale, в data дополнительно попадают Brand и Locale
+func (r *Renderer) Render(to, name, locale string, data map[string]interface{}) (*Message, error) {
+	if !r.Supports(locale) {
+		locale = r.defaultLocale
+	}
+
+	tmpl, err := r.load(name, locale)
+	if err != nil && locale != r.defaultLocale {
+		locale = r.defaultLocale
+		tmpl, err = r.load(name, locale)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Brand"] = r.brand
+	values["Locale"] = locale
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, values); err != nil {
+		return nil, fmt.Errorf("ошибка шаблона темы %s: %w", name, err)
+	}
+	if err := tmpl.text.Execute(&text, values); err != nil {
+		return nil, fmt.Errorf("ошибка текстового шаблона %s: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", values); err != nil {
+		return nil, fmt.Errorf("ошибка HTML шаблона %s: %w", name, err)
+	}
+
+	return &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+func (r *Renderer) load(name, locale string) (*parsedTemplate, error) {
+	key := locale + "/" + name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if tmpl, ok := r.cache[key]; ok {
+		return tmpl, nil
+	}
+
+	subject, err := texttemplate.ParseFS(r.fsys, key+".subject.txt")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки шаблона %s: %w", key, err)
+	}
+	text, err := texttemplate.ParseFS(r.fsys, key+".txt")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки шаблона %s: %w", key, err)
+	}
+	html, err := htmltemplate.ParseFS(r.fsys, "layout.html", key+".html")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки шаблона %s: %w", key, err)
+	}
+
+	tmpl := &parsedTemplate{subject: subject, text: text, html: html}
+	r.cache[key] = tmpl
+	return tmpl, nil
+}
+
+// файл берется из первого слоя, где он есть
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		file, err := layer.Open(name)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
@@ -2,20 +2,21 @@ package middleware
 
 import (
 	"auth-service/internal/utils"
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// проверка, что токен не отозван: сессия жива и версия токенов пользователя не менялась
+type TokenStateChecker interface {
+	CheckAccessToken(claims *utils.Claims) error
+}
+
+func AuthMiddleware(checker TokenStateChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		fmt.Printf("🎯 ДЕБАГ AuthMiddleware - Authorization header: '%s'\n", authHeader)
-
 		if authHeader == "" {
-			fmt.Printf("❌ ДЕБАГ AuthMiddleware - Authorization header is empty\n")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Требуется авторизация",
 			})
@@ -23,11 +24,8 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		accessToken := strings.Replace(authHeader, "Bearer ", "", 1)
-		fmt.Printf("🎯 ДЕБАГ AuthMiddleware - Extracted token: '%s...'\n", accessToken[:50])
-
-		if accessToken == "" {
-			fmt.Printf("❌ ДЕБАГ AuthMiddleware - Token is empty after extraction\n")
+		accessToken, ok := strings.CutPrefix(authHeader, "Bearer ")
+		if !ok || accessToken == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Неверный формат токена",
 			})
@@ -35,11 +33,8 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		fmt.Printf("🎯 ДЕБАГ AuthMiddleware - Validating token...\n")
 		claims, err := utils.ValidateToken(accessToken)
 		if err != nil {
-			fmt.Printf("❌ ДЕБАГ AuthMiddleware - Token validation FAILED: %v\n", err)
-			fmt.Printf("❌ ДЕБАГ AuthMiddleware - Error details: %+v\n", err)
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Невалидный токен: " + err.Error(),
 			})
@@ -47,15 +42,27 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		fmt.Printf("✅ ДЕБАГ AuthMiddleware - Token validation SUCCESS\n")
-		fmt.Printf("✅ ДЕБАГ AuthMiddleware - UserID: %d, Email: %s, Role: %s\n",
-			claims.UserID, claims.Email, claims.Role)
+		if err := checker.CheckAccessToken(claims); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Невалидный токен: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
+		// У ТОКЕНА СЕРВИСА НЕТ ПОЛЬЗОВАТЕЛЯ, user_id НЕ ЗАДАЕТСЯ
+		c.Set("subject_type", claims.SubjectKind())
+		c.Set("client_id", claims.ClientID)
+		c.Set("token_scope", claims.Scope)
+		c.Set("token_audience", []string(claims.Audience))
+		if !claims.IsService() {
+			c.Set("user_id", claims.UserID)
+			c.Set("user_email", claims.Email)
+			c.Set("user_roles", claims.Roles)
+			c.Set("user_permissions", claims.Permissions)
+			c.Set("session_id", claims.SessionID)
+		}
 
-		fmt.Printf("✅ ДЕБАГ AuthMiddleware - Context set, proceeding to handler\n")
 		c.Next()
 	}
 }
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"auth-service/internal/ratelimit"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// лимиты одного эндпоинта: по IP и по аккаунту (значение поля AccountField из JSON тела,
+// без поля - пользователь из access токена, если лимит стоит после AuthMiddleware)
+type RateLimitRule struct {
+	Name         string
+	IP           ratelimit.Limit
+	Account      ratelimit.Limit
+	AccountField string
+}
+
+// лимиты эндпоинта name, переопределяются через RATE_LIMIT_<NAME>_IP и RATE_LIMIT_<NAME>_ACCOUNT
+// в формате "N/период", "0" отключает лимит
+func RateLimitRuleFromEnv(name, accountField, ipDefault, accountDefault string) RateLimitRule {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	return RateLimitRule{
+		Name:         name,
+		IP:           limitFromEnv(prefix+"_IP", ipDefault),
+		Account:      limitFromEnv(prefix+"_ACCOUNT", accountDefault),
+		AccountField: accountField,
+	}
+}
+
+func limitFromEnv(key, defaultValue string) ratelimit.Limit {
+	value := os.Getenv(key)
+	if value == "" {
+		value = defaultValue
+	}
+	if value == "0" {
+		return ratelimit.Limit{}
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Fatalf("❌ %s: %v", key, err)
+	}
+	return limit
+}
+
+// у каждого эндпоинта свои бюджеты, ключи не пересекаются между эндпоинтами
+func RateLimit(store ratelimit.Store, rule RateLimitRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		type check struct {
+			key   string
+			limit ratelimit.Limit
+		}
+
+		checks := []check{}
+		if rule.IP.Burst > 0 {
+			checks = append(checks, check{"ip:" + rule.Name + ":" + c.ClientIP(), rule.IP})
+		}
+		if rule.Account.Burst > 0 {
+			if account := accountKey(c, rule.AccountField); account != "" {
+				checks = append(checks, check{"account:" + rule.Name + ":" + account, rule.Account})
+			}
+		}
+
+		var strictest *ratelimit.Result
+		for _, item := range checks {
+			result, err := store.Take(item.key, item.limit)
+			if err != nil {
+				// НЕДОСТУПНОЕ ХРАНИЛИЩЕ НЕ ДОЛЖНО ЛОЖИТЬ ВХОД - ПРОПУСКАЕМ
+				log.Printf("⚠️ Ошибка rate limit хранилища: %v", err)
+				continue
+			}
+			if strictest == nil || stricter(result, strictest) {
+				strictest = result
+			}
+		}
+
+		if strictest == nil {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(strictest.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(strictest.Remaining))
+		c.Header("RateLimit-Reset", seconds(strictest.ResetAfter))
+
+		if !strictest.Allowed {
+			c.Header("Retry-After", seconds(strictest.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Слишком много запросов, попробуйте позже",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// в заголовки попадает самый строгий бюджет: отказ с самым долгим ожиданием или меньший остаток
+func stricter(a, b *ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func accountKey(c *gin.Context, field string) string {
+	if field == "" {
+		if userID := c.GetUint("user_id"); userID != 0 {
+			return "user-" + strconv.FormatUint(uint64(userID), 10)
+		}
+		return ""
+	}
+	return accountFromBody(c, field)
+}
+
+// читает поле из JSON тела и возвращает тело обратно для хендлера.
+// в ключ попадает хеш значения, чтобы email не хранился в памяти и таблице лимитов
+func accountFromBody(c *gin.Context, field string) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+
+	value, _ := payload[field].(string)
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
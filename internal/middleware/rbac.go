@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"auth-service/internal/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// пускает, если в токене есть все перечисленные права. Ставится после AuthMiddleware
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("user_permissions")
+		for _, permission := range permissions {
+			if !contains(granted, permission) {
+				forbidden(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// пускает, если у пользователя есть хотя бы одна из ролей. Ставится после AuthMiddleware
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("user_roles")
+		for _, role := range roles {
+			if contains(granted, role) {
+				c.Next()
+				return
+			}
+		}
+		forbidden(c)
+	}
+}
+
+// пускает только токены указанного типа: utils.SubjectUser или utils.SubjectService.
+// Ставится после AuthMiddleware
+func RequireSubjectType(subjectType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("subject_type") != subjectType {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// пускает только токены, выданные самому сервису: без client_id и с aud utils.FirstPartyAudience().
+// Токены приложений OAuth и сервисов на эндпоинты аккаунта и администрирования не действуют.
+// Ставится после AuthMiddleware
+func RequireFirstParty() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("client_id") != "" || !contains(c.GetStringSlice("token_audience"), utils.FirstPartyAudience()) {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// пускает, если токену выданы все перечисленные scope. Ставится после AuthMiddleware
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := strings.Fields(c.GetString("token_scope"))
+		for _, scope := range scopes {
+			if !contains(granted, scope) {
+				forbidden(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func forbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": "Недостаточно прав",
+	})
+	c.Abort()
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
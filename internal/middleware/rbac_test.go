@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"auth-service/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// прогоняет handler с заранее заполненным контекстом, как после AuthMiddleware
+func runWithContext(handler gin.HandlerFunc, values map[string]any) int {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	for key, value := range values {
+		c.Set(key, value)
+	}
+	handler(c)
+	if !c.IsAborted() {
+		return http.StatusOK
+	}
+	return recorder.Code
+}
+
+func TestRequireFirstParty(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+	t.Setenv("JWT_AUDIENCE", "")
+
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   int
+	}{
+		{"собственный токен", map[string]any{"client_id": "", "token_audience": []string{"auth-service"}}, http.StatusOK},
+		{"собственный токен без aud", map[string]any{"client_id": ""}, http.StatusForbidden},
+		{"чужой aud", map[string]any{"client_id": "", "token_audience": []string{"orders-api"}}, http.StatusForbidden},
+		{"токен приложения", map[string]any{"client_id": "crm", "token_audience": []string{"crm"}}, http.StatusForbidden},
+		{"токен приложения с aud сервиса", map[string]any{"client_id": "crm", "token_audience": []string{"auth-service"}}, http.StatusForbidden},
+		{"токен client_credentials", map[string]any{"client_id": "billing", "subject_type": "service", "token_audience": []string{"orders-api"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runWithContext(RequireFirstParty(), tt.values); got != tt.want {
+				t.Fatalf("статус %d, ожидали %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope string
+		want  int
+	}{
+		{"scope выдан", "openid email", http.StatusOK},
+		{"scope не выдан", "email profile", http.StatusForbidden},
+		{"без scope", "", http.StatusForbidden},
+		{"совпадение части слова не считается", "openid2", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runWithContext(RequireScope("openid"), map[string]any{"token_scope": tt.scope}); got != tt.want {
+				t.Fatalf("статус %d, ожидали %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSubjectType(t *testing.T) {
+	tests := []struct {
+		name        string
+		subjectType string
+		want        int
+	}{
+		{"пользователь", utils.SubjectUser, http.StatusOK},
+		{"сервис", utils.SubjectService, http.StatusForbidden},
+		{"тип не задан", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runWithContext(RequireSubjectType(utils.SubjectUser), map[string]any{"subject_type": tt.subjectType}); got != tt.want {
+				t.Fatalf("статус %d, ожидали %d", got, tt.want)
+			}
+		})
+	}
+}
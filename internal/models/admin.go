@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// фильтр списка пользователей, After - курсор: id последнего пользователя предыдущей страницы
+type UserFilter struct {
+	Query     string // подстрока email, имени или фамилии
+	Role      string
+	Status    string // active, disabled, locked или deleted
+	TwoFactor string // email или totp
+	After     uint
+	Limit     int
+}
+
+// пустые поля не меняются, Roles заменяет все роли пользователя
+type AdminUpdateUserRequest struct {
+	Name     *string  `json:"name" binding:"omitempty,min=2,max=100"`
+	Lastname *string  `json:"lastname" binding:"omitempty,min=2,max=100"`
+	Email    *string  `json:"email" binding:"omitempty,email"`
+	Roles    []string `json:"roles"`
+}
+
+type AdminTwoFactorState struct {
+	Method                 string `json:"method"`
+	Enabled                bool   `json:"enabled"`
+	RecoveryCodesRemaining int64  `json:"recovery_codes_remaining"`
+	Passkeys               int    `json:"passkeys"`
+}
+
+// выгрузка данных пользователя: профиль, 2FA, ключи доступа, сессии и журнал аудита
+type AccountExport struct {
+	ExportedAt time.Time            `json:"exported_at"`
+	Profile    *User                `json:"profile"`
+	TwoFactor  AdminTwoFactorState  `json:"two_factor"`
+	Passkeys   []WebAuthnCredential `json:"passkeys"`
+	Sessions   []SessionInfo        `json:"sessions"`
+	AuthEvents []AuthEvent          `json:"auth_events"`
+}
+
+type AdminUserResponse struct {
+	User      *User               `json:"user"`
+	TwoFactor AdminTwoFactorState `json:"two_factor"`
+	Sessions  []SessionInfo       `json:"sessions"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// запись журнала аудита auth_events, только добавляется
+type AuthEvent struct {
+	ID            uint64    `gorm:"primaryKey" json:"id"`
+	ActorID       *uint     `gorm:"index" json:"actor_id"` // кто выполнил действие: сам пользователь или администратор
+	UserID        *uint     `gorm:"index" json:"user_id"`  // чей аккаунт затронут, nil - неизвестен (например, неверный email)
+	Type          string    `gorm:"size:50;not null;index" json:"type"`
+	Outcome       string    `gorm:"size:10;not null" json:"outcome"` // "success" или "failure"
+	IP            string    `gorm:"size:45" json:"ip"`
+	UserAgent     string    `gorm:"size:512" json:"user_agent"`
+	CorrelationID string    `gorm:"size:64;index" json:"correlation_id"` // X-Request-ID запроса
+	Details       string    `gorm:"type:text" json:"details"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+}
+
+// фильтр журнала, Before - курсор: id последнего события предыдущей страницы
+type AuthEventFilter struct {
+	UserID  *uint
+	ActorID *uint
+	Types   []string
+	Outcome string
+	From    *time.Time
+	To      *time.Time
+	Before  uint64
+	Limit   int
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// письмо в очереди на отправку, пишется в одной транзакции с кодом или токеном
+type EmailOutbox struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Recipient     string     `gorm:"size:255;not null" json:"recipient"`
+	Subject       string     `gorm:"size:255;not null" json:"subject"`
+	HTML          string     `gorm:"type:text" json:"-"` // зашифрован EMAIL_ENCRYPTION_KEY, очищается после отправки, содержит коды и ссылки
+	Text          string     `gorm:"type:text" json:"-"`
+	Status        string     `gorm:"size:20;not null;default:pending;index" json:"status"` // pending, sent или dead
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
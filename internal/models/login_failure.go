@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// неудачные входы по паролю с одного IP, общие для всех реплик
+type IPLoginFailure struct {
+	IP           string     `gorm:"primaryKey;size:45" json:"ip"`
+	Failures     int        `gorm:"not null;default:0" json:"failures"`
+	LockoutCount int        `gorm:"not null;default:0" json:"lockout_count"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
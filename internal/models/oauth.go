@@ -0,0 +1,148 @@
+package models
+
+import "time"
+
+// зарегистрированное приложение OAuth. Секрет хранится только в виде bcrypt-хеша,
+// у публичного клиента (SPA, мобильное приложение) секрета нет и PKCE обязателен
+type OAuthClient struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ClientID        string    `gorm:"size:100;uniqueIndex;not null" json:"client_id"`
+	Name            string    `gorm:"size:100;not null" json:"name"`
+	SecretHash      string    `gorm:"size:255" json:"-"`
+	Public          bool      `gorm:"not null;default:false" json:"public"`
+	RedirectURIs    []string  `gorm:"type:text;serializer:json" json:"redirect_uris"`
+	GrantTypes      []string  `gorm:"type:text;serializer:json" json:"grant_types"`
+	Scopes          []string  `gorm:"type:text;serializer:json" json:"scopes"`
+	Audiences       []string  `gorm:"type:text;serializer:json" json:"audiences"`   // aud в access токенах, пусто - client_id
+	AccessTokenTTL  int       `gorm:"not null;default:0" json:"access_token_ttl"`   // секунды, 0 - ACCESS_TOKEN_EXPIRE_MINUTES
+	RefreshTokenTTL int       `gorm:"not null;default:0" json:"refresh_token_ttl"`  // секунды, 0 - 7 дней
+	IntrospectAll   bool      `gorm:"not null;default:false" json:"introspect_all"` // интроспекция любых access токенов (шлюз)
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (OAuthClient) TableName() string {
+	return "clients"
+}
+
+// client_id можно не указывать, тогда он генерируется
+type CreateOAuthClientRequest struct {
+	ClientID string `json:"client_id" binding:"omitempty,min=3,max=100"`
+	Public   bool   `json:"public"`
+	UpdateOAuthClientRequest
+}
+
+// заменяет название и всю политику клиента, client_id и тип клиента не меняются
+type UpdateOAuthClientRequest struct {
+	Name            string   `json:"name" binding:"required,max=100"`
+	RedirectURIs    []string `json:"redirect_uris"`
+	GrantTypes      []string `json:"grant_types"`
+	Scopes          []string `json:"scopes"`
+	Audiences       []string `json:"audiences"`
+	AccessTokenTTL  int      `json:"access_token_ttl" binding:"min=0"`
+	RefreshTokenTTL int      `json:"refresh_token_ttl" binding:"min=0"`
+	IntrospectAll   bool     `json:"introspect_all"`
+}
+
+// секрет показывается один раз: при создании клиента и при его замене
+type OAuthClientSecretResponse struct {
+	Client       *OAuthClient `json:"client"`
+	ClientSecret string       `json:"client_secret,omitempty"`
+}
+
+// запрос авторизации от /oauth/authorize до обмена кода на токены.
+// UserID и CodeHash заполняются после входа пользователя, UsedAt - после обмена кода
+type OAuthAuthorization struct {
+	ID                  uint       `gorm:"primaryKey" json:"-"`
+	UUID                string     `gorm:"size:36;uniqueIndex;not null" json:"authorization_request"`
+	ClientID            string     `gorm:"size:100;not null" json:"client_id"`
+	RedirectURI         string     `gorm:"type:text;not null" json:"-"`
+	Scope               string     `gorm:"size:255;not null" json:"scope"`
+	State               string     `gorm:"type:text" json:"-"`
+	Nonce               string     `gorm:"type:text" json:"-"`
+	CodeChallenge       string     `gorm:"size:128;not null" json:"-"`
+	CodeChallengeMethod string     `gorm:"size:10;not null" json:"-"`
+	UserID              *uint      `json:"-"`
+	CodeHash            *string    `gorm:"size:64;uniqueIndex" json:"-"`
+	AuthTime            *time.Time `json:"-"`
+	FamilyID            string     `gorm:"size:36" json:"-"` // сессия, выданная по коду, отзывается при повторном предъявлении кода
+	ExpiresAt           time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt              *time.Time `json:"-"`
+	CreatedAt           time.Time  `json:"-"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	Prompt              string `form:"prompt"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// то, что страница входа показывает пользователю
+type AuthorizationRequestInfo struct {
+	AuthorizationRequest string    `json:"authorization_request"`
+	ClientID             string    `json:"client_id"`
+	ClientName           string    `json:"client_name"`
+	Scopes               []string  `json:"scopes"`
+	ExpiresAt            time.Time `json:"expires_at"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// token_type_hint: access_token или refresh_token, с какого типа начинать поиск
+type IntrospectRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type RevokeRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// ответ /oauth/introspect по RFC 7662, у неактивного токена только active: false
+type IntrospectionResponse struct {
+	Active      bool     `json:"active"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	TokenType   string   `json:"token_type,omitempty"` // Bearer или refresh_token
+	ExpiresAt   int64    `json:"exp,omitempty"`
+	IssuedAt    int64    `json:"iat,omitempty"`
+	Subject     string   `json:"sub,omitempty"`
+	Audience    []string `json:"aud,omitempty"`
+	Issuer      string   `json:"iss,omitempty"`
+	SubjectType string   `json:"sub_type,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	UserID      uint     `json:"user_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+}
+
+// ответ /oauth/token по RFC 6749
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// права, которые проверяются в коде. Новые права добавляются миграцией вместе с кодом, который их проверяет
+const (
+	PermAuditRead     = "audit:read"
+	PermClientsManage = "clients:manage"
+	PermRolesManage   = "roles:manage"
+	PermUsersRead     = "users:read"
+	PermUsersUnlock   = "users:unlock"
+	PermUsersWrite    = "users:write"
+)
+
+// роль, которую получает каждый новый пользователь
+const DefaultRole = "user"
+
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"size:50;uniqueIndex;not null" json:"name"`
+	Description string       `gorm:"size:255" json:"description"`
+	System      bool         `gorm:"not null;default:false" json:"system"` // встроенная роль, удалить нельзя
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Description string `gorm:"size:255" json:"description"`
+}
+
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	RoleID    uint      `gorm:"primaryKey" json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=2,max=50"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// заменяет описание и весь набор прав роли
+type UpdateRoleRequest struct {
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ключ подписи JWT: active - подписываем, verify_only - только проверяем, retired - не принимаем
+type SigningKey struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	KID         string     `gorm:"column:kid;size:100;uniqueIndex;not null" json:"kid"`
+	Algorithm   string     `gorm:"size:10;not null" json:"algorithm"`
+	PrivateKey  string     `gorm:"type:text;not null" json:"-"` // PEM, PKCS#8, зашифрован JWT_KEY_ENCRYPTION_KEY
+	Status      string     `gorm:"size:20;not null;default:verify_only" json:"status"`
+	ActivatedAt *time.Time `json:"activated_at"`
+	RetiredAt   *time.Time `json:"retired_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -5,25 +5,69 @@ import (
 )
 
 type User struct {
-	ID                uint      `gorm:"primaryKey" json:"id"`
-	Name              string    `gorm:"size:100;not null" json:"name"`
-	Lastname          string    `gorm:"size:100;not null" json:"lastname"`
-	Email             string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
-	PasswordHash      string    `gorm:"size:255;not null" json:"-"`
-	Role              string    `gorm:"size:50;not null;default:user" json:"role"`
-	TwoFactorEnabled  bool      `gorm:"default:false" json:"two_factor_enabled"`
-	TwoFactorSecret   string    `gorm:"size:255" json:"-"`
-	TwoFactorVerified bool      `gorm:"default:false" json:"two_factor_verified"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                    uint       `gorm:"primaryKey" json:"id"`
+	Name                  string     `gorm:"size:100;not null" json:"name"`
+	Lastname              string     `gorm:"size:100;not null" json:"lastname"`
+	Email                 string     `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	PasswordHash          string     `gorm:"size:255;not null" json:"-"`
+	TwoFactorEnabled      bool       `gorm:"default:false" json:"two_factor_enabled"`
+	TwoFactorSecret       string     `gorm:"size:255" json:"-"`
+	TwoFactorVerified     bool       `gorm:"default:false" json:"two_factor_verified"`
+	TwoFactorMethod       string     `gorm:"size:20;not null;default:email" json:"two_factor_method"` // "email" или "totp"
+	TOTPLastStep          int64      `gorm:"column:totp_last_step;not null;default:0" json:"-"`       // шаг последнего принятого кода TOTP
+	Locale                string     `gorm:"size:10" json:"locale"`                                   // язык писем, пусто - по Accept-Language
+	TokenVersion          int        `gorm:"not null;default:1" json:"-"`                             // увеличивается, когда выданные access токены должны перестать работать
+	FailedCodeAttempts    int        `gorm:"not null;default:0" json:"-"`                             // неверные коды подряд во всех сессиях верификации
+	FailedLoginAttempts   int        `gorm:"not null;default:0" json:"-"`                             // неверные пароли подряд
+	LockoutCount          int        `gorm:"not null;default:0" json:"-"`                             // блокировки подряд, от них растет длительность следующей
+	LockedUntil           *time.Time `json:"locked_until,omitempty"`
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`                                 // отключен администратором, вход запрещен
+	PasswordResetRequired bool       `gorm:"not null;default:false" json:"password_reset_required"` // вход только после сброса пароля
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`                       // удаление запрошено, в это время аккаунт удаляется безвозвратно
+	Roles                 []string   `gorm:"-" json:"roles,omitempty"`                              // из user_roles, заполняется сервисом
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
 }
 
 type Session struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	UserID       uint      `gorm:"not null" json:"user_id"`
-	RefreshToken string    `gorm:"size:255;uniqueIndex;not null" json:"-"`
-	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	UserID           uint       `gorm:"not null" json:"user_id"`
+	RefreshTokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	FamilyID         string     `gorm:"size:36;index;not null" json:"family_id"` // общий для всей цепочки ротаций
+	RotatedAt        *time.Time `json:"rotated_at"`                              // токен уже обменян на новый
+	UserAgent        string     `gorm:"size:512" json:"user_agent"`
+	IP               string     `gorm:"size:45" json:"ip"`
+	ClientLabel      string     `gorm:"size:100" json:"client_label"`
+	ClientID         string     `gorm:"size:100;index" json:"client_id,omitempty"` // приложение OAuth, пусто - вход в сервис напрямую
+	Scope            string     `gorm:"size:255" json:"scope,omitempty"`           // scope, выданный приложению
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"` // при ротации переносится с первой сессии цепочки
+}
+
+// откуда пришел запрос, сохраняется в сессии
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+	Label     string
+	// Accept-Language запроса, по нему выбирается язык писем
+	AcceptLanguage string
+	// для журнала аудита: аутентифицированный автор запроса (0 - аноним) и X-Request-ID
+	ActorID   uint
+	RequestID string
+}
+
+// сессия для пользователя, ID - идентификатор цепочки, он не меняется при обновлении токенов
+type SessionInfo struct {
+	ID          string    `json:"id"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	ClientLabel string    `json:"client_label"`
+	ClientID    string    `json:"client_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Current     bool      `json:"current"`
 }
 
 type TwoFactorCode struct {
@@ -39,37 +83,62 @@ type VerificationSession struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UUID      string    `gorm:"size:36;uniqueIndex;not null" json:"activated_link"`
 	Email     string    `gorm:"size:255;not null" json:"email"`
-	Code      string    `gorm:"size:10;not null" json:"code"`
-	Operation string    `gorm:"size:20;not null" json:"operation"` // "register" или "login"
+	CodeHash  string    `gorm:"size:64;not null" json:"-"`
+	Operation string    `gorm:"size:20;not null" json:"operation"`     // "register", "login", "login_totp", "email_change", "email_change_undo", "account_delete" или "account_restore"
+	Payload   string    `gorm:"size:255;not null;default:''" json:"-"` // данные операции, например новый email
+	UserID    *uint     `gorm:"index" json:"-"`                        // для email_change_undo: аккаунт, email которого возвращается
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	Used      bool      `gorm:"default:false" json:"used"`
+	Attempts  int       `gorm:"not null;default:0" json:"-"` // попытки ввода кода, не больше VERIFY_MAX_ATTEMPTS
 	CreatedAt time.Time `json:"created_at"`
 }
 
 type ResetPasswordToken struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"not null" json:"user_id"`
-	Token     string    `gorm:"size:255;uniqueIndex;not null" json:"token"`
+	TokenHash string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	Used      bool      `gorm:"default:false" json:"used"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// одноразовая ссылка из письма о блокировке аккаунта
+type AccountUnlockToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	TokenHash string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	Used      bool      `gorm:"default:false" json:"used"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 type RegisterRequest struct {
 	Name     string `json:"name" binding:"required,min=2,max=100"`
 	Lastname string `json:"lastname" binding:"required,min=2,max=100"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=5"`
+	Locale   string `json:"locale" binding:"omitempty,max=10"`
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=5"`
+	// запрос авторизации из /oauth/authorize, после проверки кода клиент получит redirect_to вместо токенов
+	AuthorizationRequest string `json:"authorization_request" binding:"omitempty,max=36"`
 }
 
 type VerifyRequest struct {
 	ActivatedLink string `json:"activated_link" binding:"required"`
-	Code          string `json:"code" binding:"required,len=6"`
+	Code          string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6"`
+	RecoveryCode  string `json:"recovery_code" binding:"required_without=Code"`
 }
 
 type RegisterResponse struct {
@@ -78,32 +147,84 @@ type RegisterResponse struct {
 }
 
 type LoginResponse struct {
-	Message       string `json:"message"`
-	ActivatedLink string `json:"activated_link"`
+	Message         string `json:"message"`
+	ActivatedLink   string `json:"activated_link"`
+	TwoFactorMethod string `json:"two_factor_method"`
 }
 
 type VerifyResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	User         *User  `json:"user"`
+	AccessToken            string   `json:"access_token"`
+	RefreshToken           string   `json:"refresh_token"`
+	User                   *User    `json:"user"`
+	RecoveryCodes          []string `json:"recovery_codes,omitempty"`
+	RecoveryCodesRemaining *int     `json:"recovery_codes_remaining,omitempty"`
+	RedirectTo             string   `json:"redirect_to,omitempty"` // вход через /oauth/authorize: адрес приложения с кодом авторизации
 }
 
 type ProfileResponse struct {
-	ID       uint   `json:"id"`
-	Name     string `json:"name"`
-	Lastname string `jsoыn:"lastname"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+	ID       uint     `json:"id"`
+	Name     string   `json:"name"`
+	Lastname string   `jsoыn:"lastname"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
 }
 
 type TokenResponse struct {
 	Message string `json:"message"`
 }
 
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope" binding:"omitempty,oneof=current all"`
+}
+
+type UpdateProfileRequest struct {
+	Name     string `json:"name" binding:"required,min=2,max=100"`
+	Lastname string `json:"lastname" binding:"required,min=2,max=100"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=5"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	ActivatedLink string `json:"activated_link" binding:"required"`
+	Code          string `json:"code" binding:"required,len=6"`
+}
+
+type UndoEmailChangeRequest struct {
+	ActivatedLink string `json:"activated_link" binding:"required"`
+	Token         string `json:"token" binding:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmAccountDeletionRequest struct {
+	ActivatedLink string `json:"activated_link" binding:"required"`
+	Code          string `json:"code" binding:"required,len=6"`
+}
+
+type RestoreAccountRequest struct {
+	ActivatedLink string `json:"activated_link" binding:"required"`
+	Token         string `json:"token" binding:"required"`
+}
+
 type RequestResetPasswordRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
 type ResetPasswordRequest struct {
 	Token       string `json:"token" binding:"required"`
 	NewPassword string `json:"new_password" binding:"required,min=5"`
@@ -123,3 +244,21 @@ type Verify2FAResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	User         *User  `json:"user"`
 }
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6"`
+}
+
+type RegenerateRecoveryCodesRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
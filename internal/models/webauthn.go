@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebAuthnCredential struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	CredentialID []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	Name         string     `gorm:"size:100" json:"name"`
+	Data         string     `gorm:"type:text;not null" json:"-"` // webauthn.Credential в JSON
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// состояние церемонии между begin и finish
+type WebAuthnSession struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UUID      string    `gorm:"size:36;uniqueIndex;not null" json:"session_id"`
+	UserID    *uint     `json:"user_id"`                           // nil для входа, пользователь определяется по ключу
+	Operation string    `gorm:"size:20;not null" json:"operation"` // "register" или "login"
+	Data      string    `gorm:"type:text;not null" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebAuthnBeginResponse struct {
+	SessionID string `json:"session_id"`
+	Options   any    `json:"options"`
+}
+
+type WebAuthnFinishRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+	Name       string          `json:"name" binding:"max=100"`
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// бюджеты в памяти процесса, у каждой реплики свои
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+	go store.cleanupLoop()
+	return store
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.ratePerSecond())
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return newResult(false, b.tokens, limit), nil
+	}
+
+	b.tokens--
+	return newResult(true, b.tokens, limit), nil
+}
+
+// бюджет, не использовавшийся сутки, уже восстановился (периоды лимитов короче суток) - он не нужен
+func (s *MemoryStore) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		cutoff := s.now().Add(-24 * time.Hour)
+		for key, b := range s.buckets {
+			if b.updatedAt.Before(cutoff) {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{"10/1m", Limit{Burst: 10, Period: time.Minute}, false},
+		{"100/1h", Limit{Burst: 100, Period: time.Hour}, false},
+		{"5/30s", Limit{Burst: 5, Period: 30 * time.Second}, false},
+		{"10", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"x/1m", Limit{}, true},
+		{"10/0s", Limit{}, true},
+		{"10/минута", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("ParseLimit(%q) = %v, %v", tt.value, got, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	limit := Limit{Burst: 3, Period: time.Minute} // токен каждые 20 секунд
+
+	type take struct {
+		after      time.Duration // сдвиг часов перед запросом
+		key        string
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{"бюджет расходуется и запрос сверх него отклоняется", []take{
+			{0, "a", true, 2, 0},
+			{0, "a", true, 1, 0},
+			{0, "a", true, 0, 0},
+			{0, "a", false, 0, 20 * time.Second},
+		}},
+		{"retry-after уменьшается со временем", []take{
+			{0, "a", true, 2, 0},
+			{0, "a", true, 1, 0},
+			{0, "a", true, 0, 0},
+			{5 * time.Second, "a", false, 0, 15 * time.Second},
+		}},
+		{"токен восстанавливается за period/burst", []take{
+			{0, "a", true, 2, 0},
+			{0, "a", true, 1, 0},
+			{0, "a", true, 0, 0},
+			{20 * time.Second, "a", true, 0, 0},
+			{0, "a", false, 0, 20 * time.Second},
+		}},
+		{"бюджет не копится выше burst", []take{
+			{0, "a", true, 2, 0},
+			{time.Hour, "a", true, 2, 0},
+		}},
+		{"ключи не делят бюджет", []take{
+			{0, "a", true, 2, 0},
+			{0, "a", true, 1, 0},
+			{0, "a", true, 0, 0},
+			{0, "b", true, 2, 0},
+			{0, "a", false, 0, 20 * time.Second},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+			store := &MemoryStore{buckets: map[string]*bucket{}, now: func() time.Time { return now }}
+
+			for i, step := range tt.takes {
+				now = now.Add(step.after)
+				result, err := store.Take(step.key, limit)
+				if err != nil {
+					t.Fatalf("запрос %d: %v", i, err)
+				}
+				if result.Allowed != step.allowed || result.Remaining != step.remaining || result.RetryAfter != step.retryAfter {
+					t.Fatalf("запрос %d: allowed=%t remaining=%d retry_after=%s, ожидали %t %d %s",
+						i, result.Allowed, result.Remaining, result.RetryAfter, step.allowed, step.remaining, step.retryAfter)
+				}
+			}
+		})
+	}
+}
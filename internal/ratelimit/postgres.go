@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// бюджеты в таблице rate_limit_buckets, общие для всех реплик.
+// восполнение и списание делаются одним UPSERT, поэтому гонок между репликами нет
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	store := &PostgresStore{db: db}
+	go store.cleanupLoop()
+	return store
+}
+
+const takeSQL = `
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (@key, @burst - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE SET
+    tokens = CASE
+        WHEN LEAST(@burst, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * @rate) >= 1
+        THEN LEAST(@burst, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * @rate) - 1
+        ELSE LEAST(@burst, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * @rate)
+    END,
+    allowed = LEAST(@burst, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * @rate) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed`
+
+func (s *PostgresStore) Take(key string, limit Limit) (*Result, error) {
+	var row struct {
+		Tokens  float64
+		Allowed bool
+	}
+
+	err := s.db.Raw(takeSQL, map[string]interface{}{
+		"key":   key,
+		"burst": float64(limit.Burst),
+		"rate":  limit.ratePerSecond(),
+	}).Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return newResult(row.Allowed, row.Tokens, limit), nil
+}
+
+func (s *PostgresStore) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := s.db.Exec("DELETE FROM rate_limit_buckets WHERE updated_at < ?", time.Now().Add(-24*time.Hour)).Error
+		if err != nil {
+			log.Printf("⚠️ Ошибка очистки rate_limit_buckets: %v", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// бюджет token bucket: Burst запросов подряд, восполняется полностью за Period
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+func (l Limit) ratePerSecond() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// разбирает лимит вида "10/1m" или "100/1h"
+func ParseLimit(value string) (Limit, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("неверный формат лимита %q, ожидается N/период", value)
+	}
+
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("неверное число запросов в лимите %q", value)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("неверный период в лимите %q", value)
+	}
+
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // через сколько появится следующий токен, если запрос отклонен
+	ResetAfter time.Duration // через сколько бюджет восстановится полностью
+}
+
+// хранилище бюджетов: в памяти процесса или общее для всех реплик
+type Store interface {
+	Take(key string, limit Limit) (*Result, error)
+}
+
+// считает результат по числу токенов после списания (или попытки списания)
+func newResult(allowed bool, tokens float64, limit Limit) *Result {
+	rate := limit.ratePerSecond()
+	result := &Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(limit.Burst) - tokens) / rate * float64(time.Second)),
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// at - время безвозвратного удаления, nil отменяет удаление
+func (r *UserRepository) ScheduleUserDeletion(userID uint, at *time.Time) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"deletion_scheduled_at": at,
+		"updated_at":            time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) GetUsersDueForPurge(before time.Time, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", before).
+		Order("deletion_scheduled_at").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// безвозвратно удаляет пользователя со всеми сессиями, кодами, токенами и письмами в очереди. false - аккаунт
+// уже удален или восстановлен. Журнал auth_events не трогаем: он только дополняется, не ссылается на users
+// и не хранит email (старые записи очищены миграцией 026)
+func (r *UserRepository) PurgeUser(user *models.User) (bool, error) {
+	purged := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// БЛОКИРУЕМ СТРОКУ, ЧТОБЫ ПАРАЛЛЕЛЬНОЕ ВОССТАНОВЛЕНИЕ ИЛИ ОЧИСТКА НЕ ПРОШЛИ ОДНОВРЕМЕННО
+		var due []uint
+		if err := tx.Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deletion_scheduled_at <= ?", user.ID, time.Now()).Pluck("id", &due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		for _, model := range []interface{}{
+			&models.Session{},
+			&models.TwoFactorCode{},
+			&models.ResetPasswordToken{},
+			&models.AccountUnlockToken{},
+			&models.RecoveryCode{},
+			&models.WebAuthnCredential{},
+			&models.WebAuthnSession{},
+			&models.UserRole{},
+			&models.OAuthAuthorization{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// ПИСЬМА УДАЛЯЕМ ДО СЕССИЙ ПОДТВЕРЖДЕНИЯ: ПО НИМ НАХОДЯТСЯ ПРЕЖНИЙ И НОВЫЙ АДРЕСА
+		if err := (&UserRepository{db: tx}).DeleteUserEmails(user); err != nil {
+			return err
+		}
+		if err := tx.Where("email = ? OR user_id = ?", user.Email, user.ID).Delete(&models.VerificationSession{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		purged = true
+		return nil
+	})
+	return purged, err
+}
+
+// удаляет из email_outbox письма на текущий адрес пользователя и на адреса из его сессий
+// подтверждения (новый email при смене, прежний в ссылке отмены). Адрес, который уже занят
+// другим пользователем, не трогаем - это его письма
+func (r *UserRepository) DeleteUserEmails(user *models.User) error {
+	var sessions []models.VerificationSession
+	if err := r.db.Select("email, payload").Where("email = ? OR user_id = ?", user.Email, user.ID).
+		Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	recipients := []string{strings.ToLower(user.Email)}
+	for _, session := range sessions {
+		for _, address := range []string{session.Email, session.Payload} {
+			if strings.Contains(address, "@") {
+				recipients = append(recipients, strings.ToLower(address))
+			}
+		}
+	}
+
+	return r.db.Where("LOWER(recipient) IN ? AND LOWER(recipient) NOT IN (SELECT LOWER(email) FROM users WHERE id <> ?)", recipients, user.ID).
+		Delete(&models.EmailOutbox{}).Error
+}
+
+// все события пользователя от новых к старым, для выгрузки данных
+func (r *UserRepository) GetAllUserAuthEvents(userID uint) ([]models.AuthEvent, error) {
+	var events []models.AuthEvent
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// пользователи по возрастанию id. Возвращает страницу, признак следующей страницы и общее число по фильтру
+func (r *UserRepository) ListUsers(filter *models.UserFilter) ([]models.User, bool, int64, error) {
+	query := r.db.Model(&models.User{})
+	if filter.Query != "" {
+		pattern := "%" + strings.ToLower(filter.Query) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(name) LIKE ? OR LOWER(lastname) LIKE ?", pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id WHERE user_roles.user_id = users.id AND roles.name = ?)", filter.Role)
+	}
+	switch filter.Status {
+	case "active":
+		query = query.Where("disabled_at IS NULL AND deletion_scheduled_at IS NULL AND (locked_until IS NULL OR locked_until <= ?)", time.Now())
+	case "disabled":
+		query = query.Where("disabled_at IS NOT NULL")
+	case "deleted":
+		query = query.Where("deletion_scheduled_at IS NOT NULL")
+	case "locked":
+		query = query.Where("locked_until > ?", time.Now())
+	}
+	if filter.TwoFactor != "" {
+		query = query.Where("two_factor_method = ?", filter.TwoFactor)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, false, 0, err
+	}
+
+	if filter.After > 0 {
+		query = query.Where("id > ?", filter.After)
+	}
+
+	var users []models.User
+	if err := query.Order("id").Limit(filter.Limit + 1).Find(&users).Error; err != nil {
+		return nil, false, 0, err
+	}
+
+	if len(users) > filter.Limit {
+		return users[:filter.Limit], true, total, nil
+	}
+	return users, false, total, nil
+}
+
+// роли сразу для страницы пользователей
+func (r *UserRepository) GetRoleNamesByUserIDs(userIDs []uint) (map[uint][]string, error) {
+	var rows []struct {
+		UserID uint
+		Name   string
+	}
+	result := map[uint][]string{}
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	err := r.db.Table("user_roles").
+		Select("user_roles.user_id, roles.name").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id IN ?", userIDs).
+		Order("roles.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		result[row.UserID] = append(result[row.UserID], row.Name)
+	}
+	return result, nil
+}
+
+// заменяет все роли пользователя
+func (r *UserRepository) ReplaceUserRoles(userID uint, roleIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		for _, roleID := range roleIDs {
+			if err := tx.Create(&models.UserRole{UserID: userID, RoleID: roleID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// at nil - включить аккаунт
+func (r *UserRepository) SetUserDisabled(userID uint, at *time.Time) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("disabled_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) RequirePasswordReset(userID uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("password_reset_required", true).Error
+}
+
+// отключает TOTP и удаляет коды восстановления, при следующем входе 2FA включится заново по коду из письма
+func (r *UserRepository) ResetTwoFactor(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+			"two_factor_method":   "email",
+			"two_factor_secret":   "",
+			"two_factor_enabled":  false,
+			"two_factor_verified": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
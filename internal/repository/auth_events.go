@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+)
+
+// в журнале нет методов обновления и удаления, таблицу дополнительно защищает триггер
+func (r *UserRepository) CreateAuthEvent(event *models.AuthEvent) error {
+	return r.db.Create(event).Error
+}
+
+// события от новых к старым. Возвращает не больше filter.Limit записей и признак, что есть следующая страница
+func (r *UserRepository) ListAuthEvents(filter *models.AuthEventFilter) ([]models.AuthEvent, bool, error) {
+	query := r.db.Model(&models.AuthEvent{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.Before > 0 {
+		query = query.Where("id < ?", filter.Before)
+	}
+
+	var events []models.AuthEvent
+	if err := query.Order("id DESC").Limit(filter.Limit + 1).Find(&events).Error; err != nil {
+		return nil, false, err
+	}
+
+	if len(events) > filter.Limit {
+		return events[:filter.Limit], true, nil
+	}
+	return events, false, nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type KeyRepository struct {
+	db *gorm.DB
+}
+
+func NewKeyRepository(db *gorm.DB) *KeyRepository {
+	return &KeyRepository{db: db}
+}
+
+func (r *KeyRepository) CreateSigningKey(key *models.SigningKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *KeyRepository) ListSigningKeys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.db.Order("created_at").Find(&keys).Error
+	return keys, err
+}
+
+// все ключи кроме выведенных из оборота
+func (r *KeyRepository) ListUsableSigningKeys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := r.db.Where("status <> ?", "retired").Order("created_at").Find(&keys).Error
+	return keys, err
+}
+
+func (r *KeyRepository) GetSigningKeyByKID(kid string) (*models.SigningKey, error) {
+	var key models.SigningKey
+	err := r.db.Where("kid = ?", kid).First(&key).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("ключ не найден")
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+// делает ключ активным, прежний активный остается только для проверки
+func (r *KeyRepository) PromoteSigningKey(kid string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var key models.SigningKey
+		if err := tx.Where("kid = ?", kid).First(&key).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.New("ключ не найден")
+			}
+			return err
+		}
+		if key.Status == "retired" {
+			return errors.New("выведенный из оборота ключ нельзя активировать")
+		}
+
+		if err := tx.Model(&models.SigningKey{}).
+			Where("status = ? AND kid <> ?", "active", kid).
+			Update("status", "verify_only").Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&key).Updates(map[string]interface{}{
+			"status":       "active",
+			"activated_at": now,
+		}).Error
+	})
+}
+
+func (r *KeyRepository) RetireSigningKey(kid string) error {
+	key, err := r.GetSigningKeyByKID(kid)
+	if err != nil {
+		return err
+	}
+	if key.Status == "active" {
+		return errors.New("нельзя вывести из оборота активный ключ, сначала активируйте другой")
+	}
+
+	now := time.Now()
+	return r.db.Model(key).Updates(map[string]interface{}{
+		"status":     "retired",
+		"retired_at": now,
+	}).Error
+}
+
+// шифрует приватные ключи, сохраненные открытым PEM. Строка обновляется, только если ключ
+// не успели поменять, возвращает число зашифрованных
+func (r *KeyRepository) EncryptLegacySigningKeys(encrypt func(kid string, privatePEM []byte) (string, error)) (int, error) {
+	var keys []models.SigningKey
+	err := r.db.Select("id, kid, private_key").
+		Where("private_key NOT LIKE 'enc:v1:%'").
+		Find(&keys).Error
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, key := range keys {
+		encrypted, err := encrypt(key.KID, []byte(key.PrivateKey))
+		if err != nil {
+			return updated, err
+		}
+		err = r.db.Model(&models.SigningKey{}).Where("id = ? AND private_key = ?", key.ID, key.PrivateKey).
+			UpdateColumn("private_key", encrypted).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
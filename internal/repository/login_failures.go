@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const registerIPLoginFailureSQL = `
+INSERT INTO ip_login_failures AS f (ip, failures, lockout_count, updated_at)
+VALUES (@ip, 1, 0, NOW())
+ON CONFLICT (ip) DO UPDATE SET
+    failures = CASE WHEN f.updated_at < NOW() - make_interval(secs => @window) THEN 1 ELSE f.failures + 1 END,
+    updated_at = NOW()
+RETURNING ip, failures, lockout_count, locked_until, updated_at`
+
+// учитывает неудачный вход с IP. Счетчик начинается заново, если прошлой ошибки не было дольше window
+func (r *UserRepository) RegisterIPLoginFailure(ip string, window time.Duration) (*models.IPLoginFailure, error) {
+	var failure models.IPLoginFailure
+	err := r.db.Raw(registerIPLoginFailureSQL, map[string]interface{}{
+		"ip":     ip,
+		"window": window.Seconds(),
+	}).Scan(&failure).Error
+	return &failure, err
+}
+
+func (r *UserRepository) GetIPLoginFailure(ip string) (*models.IPLoginFailure, error) {
+	var failure models.IPLoginFailure
+	err := r.db.Where("ip = ?", ip).First(&failure).Error
+	return &failure, err
+}
+
+func (r *UserRepository) LockIP(ip string, until time.Time) error {
+	return r.db.Model(&models.IPLoginFailure{}).Where("ip = ?", ip).UpdateColumns(map[string]interface{}{
+		"locked_until":  until,
+		"failures":      0,
+		"lockout_count": gorm.Expr("lockout_count + 1"),
+	}).Error
+}
+
+// записи без блокировки, которые давно не обновлялись, больше ни на что не влияют
+func (r *UserRepository) DeleteStaleIPLoginFailures(before time.Time) error {
+	return r.db.Where("updated_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).
+		Delete(&models.IPLoginFailure{}).Error
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *UserRepository) CreateOAuthAuthorization(authorization *models.OAuthAuthorization) error {
+	return r.db.Create(authorization).Error
+}
+
+// запрос авторизации, по которому пользователь еще не вошел
+func (r *UserRepository) GetPendingOAuthAuthorization(uuid string) (*models.OAuthAuthorization, error) {
+	var authorization models.OAuthAuthorization
+	err := r.db.Where("uuid = ? AND user_id IS NULL AND expires_at > ?", uuid, time.Now()).First(&authorization).Error
+	return &authorization, err
+}
+
+// привязывает вошедшего пользователя и код авторизации, запрос можно завершить только один раз
+func (r *UserRepository) AttachOAuthCode(uuid string, userID uint, codeHash string, expiresAt time.Time) error {
+	now := time.Now()
+	result := r.db.Model(&models.OAuthAuthorization{}).
+		Where("uuid = ? AND user_id IS NULL AND expires_at > ?", uuid, now).
+		UpdateColumns(map[string]interface{}{
+			"user_id":    userID,
+			"code_hash":  codeHash,
+			"auth_time":  now,
+			"expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// атомарно помечает код использованным, ошибка если код неизвестен, истек или уже обменян
+func (r *UserRepository) ConsumeOAuthCode(codeHash string) (*models.OAuthAuthorization, error) {
+	var authorizations []models.OAuthAuthorization
+	result := r.db.Model(&authorizations).Clauses(clause.Returning{}).
+		Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", codeHash, time.Now()).
+		UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(authorizations) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &authorizations[0], nil
+}
+
+// уже обменянный код, нужен для отзыва выданной по нему сессии при повторном предъявлении
+func (r *UserRepository) GetUsedOAuthCode(codeHash string) (*models.OAuthAuthorization, error) {
+	var authorization models.OAuthAuthorization
+	err := r.db.Where("code_hash = ? AND used_at IS NOT NULL", codeHash).First(&authorization).Error
+	return &authorization, err
+}
+
+func (r *UserRepository) SetOAuthAuthorizationFamily(id uint, familyID string) error {
+	return r.db.Model(&models.OAuthAuthorization{}).Where("id = ?", id).Update("family_id", familyID).Error
+}
+
+// обменянные коды храним сутки, чтобы заметить их повторное предъявление
+func (r *UserRepository) DeleteExpiredOAuthAuthorizations() error {
+	return r.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.OAuthAuthorization{}).Error
+}
+
+func (r *UserRepository) ListOAuthClients() ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	err := r.db.Order("client_id").Find(&clients).Error
+	return clients, err
+}
+
+func (r *UserRepository) GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.db.Where("client_id = ?", clientID).First(&client).Error
+	return &client, err
+}
+
+func (r *UserRepository) CreateOAuthClient(client *models.OAuthClient) error {
+	return r.db.Create(client).Error
+}
+
+func (r *UserRepository) UpdateOAuthClient(client *models.OAuthClient) error {
+	return r.db.Save(client).Error
+}
+
+// удаляет клиента вместе с его незавершенными запросами авторизации и сессиями,
+// возвращает цепочки удаленных сессий для отзыва выданных access токенов
+func (r *UserRepository) DeleteOAuthClient(client *models.OAuthClient) ([]string, error) {
+	var families []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where("client_id = ?", client.ClientID).
+			Distinct("family_id").Pluck("family_id", &families).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", client.ClientID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id = ?", client.ClientID).Delete(&models.OAuthAuthorization{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(client).Error
+	})
+	return families, err
+}
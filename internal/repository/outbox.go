@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ставит письмо в очередь, вызывается в транзакции вместе с созданием кода или токена
+func (r *UserRepository) EnqueueEmail(email *models.EmailOutbox) error {
+	email.Status = "pending"
+	if email.NextAttemptAt.IsZero() {
+		email.NextAttemptAt = time.Now()
+	}
+	return r.db.Create(email).Error
+}
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// забирает письма, которым пора уходить. SKIP LOCKED не дает двум репликам взять одно письмо,
+// а сдвиг next_attempt_at на lease вернет письмо в очередь, если воркер упадет во время отправки
+func (r *OutboxRepository) ClaimDueEmails(limit int, lease time.Duration) ([]models.EmailOutbox, error) {
+	var emails []models.EmailOutbox
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", "pending", now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&emails).Error; err != nil {
+			return err
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(emails))
+		for i := range emails {
+			ids[i] = emails[i].ID
+			emails[i].Attempts++
+		}
+		return tx.Model(&models.EmailOutbox{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(lease),
+		}).Error
+	})
+	return emails, err
+}
+
+// тело письма с кодами и ссылками больше не нужно и не хранится
+func (r *OutboxRepository) MarkEmailSent(id uint) error {
+	return r.db.Model(&models.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     "sent",
+		"sent_at":    time.Now(),
+		"html":       "",
+		"text":       "",
+		"last_error": "",
+	}).Error
+}
+
+func (r *OutboxRepository) RescheduleEmail(id uint, nextAttemptAt time.Time, lastError string) error {
+	return r.db.Model(&models.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+}
+
+// исчерпаны попытки: письмо остается для разбора, но без содержимого
+func (r *OutboxRepository) MarkEmailDead(id uint, lastError string) error {
+	return r.db.Model(&models.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     "dead",
+		"html":       "",
+		"text":       "",
+		"last_error": lastError,
+	}).Error
+}
+
+func (r *OutboxRepository) ListEmails(status string, limit int) ([]models.EmailOutbox, error) {
+	var emails []models.EmailOutbox
+	query := r.db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&emails).Error
+	return emails, err
+}
+
+func (r *OutboxRepository) DeleteSentEmailsBefore(before time.Time) error {
+	return r.db.Where("status = ? AND sent_at < ?", "sent", before).Delete(&models.EmailOutbox{}).Error
+}
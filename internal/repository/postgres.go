@@ -6,8 +6,12 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// сессию верификации уже закрыл другой запрос
+var ErrVerificationSessionUsed = errors.New("код или ссылка уже использованы")
+
 type UserRepository struct {
 	db *gorm.DB
 }
@@ -16,6 +20,13 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// выполняет fn в транзакции, репозиторий внутри fn работает с той же транзакцией
+func (r *UserRepository) WithTransaction(fn func(txRepo *UserRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&UserRepository{db: tx})
+	})
+}
+
 func (r *UserRepository) CreateUser(user *models.User) error {
 	return r.db.Create(user).Error
 }
@@ -38,22 +49,89 @@ func (r *UserRepository) GetUserByID(id uint) (*models.User, error) {
 	return &user, err
 }
 
-func (r *UserRepository) UpdateUser(user *models.User) error {
-	return r.db.Save(user).Error
-}
-
 func (r *UserRepository) CreateSession(session *models.Session) error {
 	return r.db.Create(session).Error
 }
 
-func (r *UserRepository) GetSessionByToken(token string) (*models.Session, error) {
+func (r *UserRepository) GetSessionByToken(tokenHash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("refresh_token_hash = ? AND rotated_at IS NULL AND expires_at > ?", tokenHash, time.Now()).First(&session).Error
+	return &session, err
+}
+
+// ищет сессию в том числе среди уже обменянных токенов, нужно для обнаружения повторного использования
+func (r *UserRepository) GetAnySessionByToken(tokenHash string) (*models.Session, error) {
 	var session models.Session
-	err := r.db.Where("refresh_token = ? AND expires_at > ?", token, time.Now()).First(&session).Error
+	err := r.db.Where("refresh_token_hash = ? AND expires_at > ?", tokenHash, time.Now()).First(&session).Error
 	return &session, err
 }
 
-func (r *UserRepository) DeleteSession(token string) error {
-	return r.db.Where("refresh_token = ?", token).Delete(&models.Session{}).Error
+// атомарно помечает токен обменянным, ошибка если его уже кто-то обменял
+func (r *UserRepository) MarkSessionRotated(id uint) error {
+	result := r.db.Model(&models.Session{}).
+		Where("id = ? AND rotated_at IS NULL", id).
+		Update("rotated_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) DeleteSessionFamily(familyID string) error {
+	return r.db.Where("family_id = ?", familyID).Delete(&models.Session{}).Error
+}
+
+// последняя (не обменянная) сессия каждой цепочки
+func (r *UserRepository) GetActiveUserSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND rotated_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *UserRepository) DeleteUserSessionFamily(userID uint, familyID string) error {
+	result := r.db.Where("user_id = ? AND family_id = ?", userID, familyID).Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) DeleteOtherUserSessions(userID uint, keepFamilyID string) error {
+	return r.db.Where("user_id = ? AND family_id <> ?", userID, keepFamilyID).Delete(&models.Session{}).Error
+}
+
+// цепочка жива, пока в ней есть не обменянный и не истекший refresh token
+func (r *UserRepository) IsSessionFamilyActive(familyID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Session{}).
+		Where("family_id = ? AND rotated_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *UserRepository) GetUserTokenVersion(userID uint) (int, error) {
+	var user models.User
+	if err := r.db.Select("token_version").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
+
+func (r *UserRepository) IncrementTokenVersion(userID uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+func (r *UserRepository) DeleteSession(tokenHash string) error {
+	return r.db.Where("refresh_token_hash = ?", tokenHash).Delete(&models.Session{}).Error
 }
 
 func (r *UserRepository) DeleteExpiredSessions() error {
@@ -86,38 +164,390 @@ func (r *UserRepository) CreateVerificationSession(session *models.VerificationS
 	return r.db.Create(session).Error
 }
 
-func (r *UserRepository) GetValidVerificationSession(uuid, code string) (*models.VerificationSession, error) {
+func (r *UserRepository) GetPendingVerificationSession(uuid string) (*models.VerificationSession, error) {
 	var session models.VerificationSession
-	err := r.db.Where("uuid = ? AND code = ? AND used = ? AND expires_at > ?", uuid, code, false, time.Now()).First(&session).Error
+	err := r.db.Where("uuid = ? AND used = ? AND expires_at > ?", uuid, false, time.Now()).First(&session).Error
 	return &session, err
 }
 
+// закрывает все открытые ссылки отмены смены email пользователя: после отмены по одной из них
+// остальные (в том числе выданные на адреса захватившего аккаунт) больше не действуют
+func (r *UserRepository) CloseEmailChangeUndoSessions(userID uint) error {
+	return r.db.Model(&models.VerificationSession{}).
+		Where("user_id = ? AND operation = ? AND used = ?", userID, "email_change_undo", false).
+		Update("used", true).Error
+}
+
+// засчитывает попытку ввода кода до его проверки: параллельные запросы не получат больше maxAttempts попыток
+func (r *UserRepository) ConsumeVerificationAttempt(uuid string, maxAttempts int) (*models.VerificationSession, error) {
+	var sessions []models.VerificationSession
+	result := r.db.Model(&sessions).Clauses(clause.Returning{}).
+		Where("uuid = ? AND used = ? AND expires_at > ? AND attempts < ?", uuid, false, time.Now(), maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(sessions) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &sessions[0], nil
+}
+
+// закрывает сессию верификации. Из параллельных запросов с верным кодом закрывает ее только один,
+// остальные получают ErrVerificationSessionUsed
 func (r *UserRepository) MarkVerificationSessionAsUsed(uuid string) error {
-	return r.db.Model(&models.VerificationSession{}).Where("uuid = ?", uuid).Update("used", true).Error
+	result := r.db.Model(&models.VerificationSession{}).Where("uuid = ? AND used = ?", uuid, false).Update("used", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVerificationSessionUsed
+	}
+	return nil
 }
 
 func (r *UserRepository) DeleteExpiredVerificationSessions() error {
 	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.VerificationSession{}).Error
 }
 
+// возвращает число неверных кодов подряд с учетом этого
+func (r *UserRepository) IncrementFailedCodeAttempts(userID uint) (int, error) {
+	var users []models.User
+	err := r.db.Model(&users).Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_code_attempts"}}}).
+		Where("id = ?", userID).
+		UpdateColumn("failed_code_attempts", gorm.Expr("failed_code_attempts + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return users[0].FailedCodeAttempts, nil
+}
+
+func (r *UserRepository) ResetFailedCodeAttempts(userID uint) error {
+	return r.db.Model(&models.User{}).Where("id = ? AND failed_code_attempts > 0", userID).
+		UpdateColumn("failed_code_attempts", 0).Error
+}
+
+// включает 2FA по коду из письма при первом подтверждении, остальные поля пользователя не трогает
+func (r *UserRepository) EnableTwoFactor(userID uint) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"two_factor_enabled":  true,
+		"two_factor_verified": true,
+	}).Error
+}
+
+// сохраняет только настройки второго фактора. Счетчики попыток, блокировку, шаг TOTP и версию токенов
+// не трогает: их уже могли изменить после чтения пользователя этот же или параллельный запрос
+func (r *UserRepository) UpdateTwoFactor(user *models.User) error {
+	return r.db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"two_factor_enabled":  user.TwoFactorEnabled,
+		"two_factor_verified": user.TwoFactorVerified,
+		"two_factor_secret":   user.TwoFactorSecret,
+		"two_factor_method":   user.TwoFactorMethod,
+	}).Error
+}
+
+// занимает шаг кода TOTP, ошибка если этот или более поздний шаг уже использован
+func (r *UserRepository) UseTOTPStep(userID uint, step int64) error {
+	result := r.db.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", userID, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// шифрует секреты TOTP, сохраненные до шифрования, возвращает число обновленных пользователей
+func (r *UserRepository) EncryptLegacyTOTPSecrets(encrypt func(userID uint, secret string) (string, error)) (int, error) {
+	var users []models.User
+	err := r.db.Select("id, two_factor_secret").
+		Where("two_factor_secret <> '' AND two_factor_secret NOT LIKE 'enc:v1:%'").
+		Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, user := range users {
+		encrypted, err := encrypt(user.ID, user.TwoFactorSecret)
+		if err != nil {
+			return updated, err
+		}
+		err = r.db.Model(&models.User{}).Where("id = ? AND two_factor_secret = ?", user.ID, user.TwoFactorSecret).
+			UpdateColumn("two_factor_secret", encrypted).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// возвращает число неверных паролей подряд с учетом этого
+func (r *UserRepository) IncrementFailedLoginAttempts(userID uint) (int, error) {
+	var users []models.User
+	err := r.db.Model(&users).Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_login_attempts"}}}).
+		Where("id = ?", userID).
+		UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return users[0].FailedLoginAttempts, nil
+}
+
+// успешный вход обнуляет счетчики, следующая блокировка снова будет самой короткой
+func (r *UserRepository) ResetLoginFailures(userID uint) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ? AND (failed_login_attempts > 0 OR lockout_count > 0)", userID).
+		UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"lockout_count":         0,
+		}).Error
+}
+
+func (r *UserRepository) LockUser(userID uint, until time.Time) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"locked_until":          until,
+		"failed_code_attempts":  0,
+		"failed_login_attempts": 0,
+		"lockout_count":         gorm.Expr("lockout_count + 1"),
+	}).Error
+}
+
+func (r *UserRepository) UnlockUser(userID uint) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"locked_until":          nil,
+		"failed_code_attempts":  0,
+		"failed_login_attempts": 0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) CreateUnlockToken(token *models.AccountUnlockToken) error {
+	return r.db.Create(token).Error
+}
+
+// атомарно гасит токен разблокировки, чтобы ссылку нельзя было использовать дважды
+func (r *UserRepository) UseUnlockToken(tokenHash string) (*models.AccountUnlockToken, error) {
+	var tokens []models.AccountUnlockToken
+	result := r.db.Model(&tokens).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used = ? AND expires_at > ?", tokenHash, false, time.Now()).
+		Update("used", true)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(tokens) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &tokens[0], nil
+}
+
+func (r *UserRepository) DeleteExpiredUnlockTokens() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.AccountUnlockToken{}).Error
+}
+
 func (r *UserRepository) CreateResetPasswordToken(token *models.ResetPasswordToken) error {
 	return r.db.Create(token).Error
 }
 
-func (r *UserRepository) GetValidResetToken(token string) (*models.ResetPasswordToken, error) {
+func (r *UserRepository) GetValidResetToken(tokenHash string) (*models.ResetPasswordToken, error) {
 	var resetToken models.ResetPasswordToken
-	err := r.db.Where("token = ? AND used = ? AND expires_at > ?", token, false, time.Now()).First(&resetToken).Error
+	err := r.db.Where("token_hash = ? AND used = ? AND expires_at > ?", tokenHash, false, time.Now()).First(&resetToken).Error
 	return &resetToken, err
 }
 
-func (r *UserRepository) MarkResetTokenAsUsed(token string) error {
-	return r.db.Model(&models.ResetPasswordToken{}).Where("token = ?", token).Update("used", true).Error
+func (r *UserRepository) MarkResetTokenAsUsed(tokenHash string) error {
+	return r.db.Model(&models.ResetPasswordToken{}).Where("token_hash = ?", tokenHash).Update("used", true).Error
 }
 
+// новый пароль снимает требование сброса от администратора
 func (r *UserRepository) UpdateUserPassword(userID uint, newPasswordHash string) error {
-	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("password_hash", newPasswordHash).Error
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"password_hash":           newPasswordHash,
+		"password_reset_required": false,
+	}).Error
+}
+
+func (r *UserRepository) UpdateUserProfile(userID uint, name, lastname string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"name":       name,
+		"lastname":   lastname,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// меняет только переданные имя и фамилию, nil - поле не трогается
+func (r *UserRepository) UpdateUserNames(userID uint, name, lastname *string) error {
+	columns := map[string]interface{}{"updated_at": time.Now()}
+	if name != nil {
+		columns["name"] = *name
+	}
+	if lastname != nil {
+		columns["lastname"] = *lastname
+	}
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(columns).Error
+}
+
+func (r *UserRepository) UpdateUserEmail(userID uint, email string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"email":      email,
+		"updated_at": time.Now(),
+	}).Error
 }
 
 func (r *UserRepository) DeleteExpiredResetTokens() error {
 	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.ResetPasswordToken{}).Error
 }
+
+func (r *UserRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range codeHashes {
+			if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// помечает код использованным, ошибка если кода нет или он уже использован.
+// Коды, еще не дохешированные ключом, сверяются по прежнему хешу
+func (r *UserRepository) UseRecoveryCode(userID uint, codeHash, legacyHash string) error {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Where("(keyed AND code_hash = ?) OR (NOT keyed AND code_hash = ?)", codeHash, legacyHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *UserRepository) CreateWebAuthnCredential(credential *models.WebAuthnCredential) error {
+	return r.db.Create(credential).Error
+}
+
+func (r *UserRepository) GetWebAuthnCredentialsByUserID(userID uint) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+func (r *UserRepository) GetWebAuthnCredentialByCredentialID(credentialID []byte) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	err := r.db.Where("credential_id = ?", credentialID).First(&credential).Error
+	return &credential, err
+}
+
+func (r *UserRepository) UpdateWebAuthnCredential(credential *models.WebAuthnCredential) error {
+	return r.db.Save(credential).Error
+}
+
+func (r *UserRepository) DeleteWebAuthnCredential(userID, id uint) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) CreateWebAuthnSession(session *models.WebAuthnSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r *UserRepository) GetValidWebAuthnSession(uuid, operation string) (*models.WebAuthnSession, error) {
+	var session models.WebAuthnSession
+	err := r.db.Where("uuid = ? AND operation = ? AND expires_at > ?", uuid, operation, time.Now()).First(&session).Error
+	return &session, err
+}
+
+func (r *UserRepository) DeleteWebAuthnSession(uuid string) error {
+	return r.db.Where("uuid = ?", uuid).Delete(&models.WebAuthnSession{}).Error
+}
+
+func (r *UserRepository) DeleteExpiredWebAuthnSessions() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{}).Error
+}
+
+// хеширует секреты, сохраненные в открытом виде до перехода на хеши, возвращает число обновленных строк.
+// Открытые строки отмечены колонкой legacy_plaintext (миграция 023), после хеширования отметка снимается.
+// Коды восстановления без ключа отмечены NOT keyed (миграция 024)
+func (r *UserRepository) HashLegacySecrets(hash func(string) string) (int, error) {
+	tables := []struct {
+		model  interface{}
+		column string
+	}{
+		{&models.Session{}, "refresh_token_hash"},
+		{&models.ResetPasswordToken{}, "token_hash"},
+		{&models.VerificationSession{}, "code_hash"},
+	}
+
+	updated := 0
+	for _, table := range tables {
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+		err := r.db.Model(table.model).
+			Select("id, " + table.column + " AS value").
+			Where("legacy_plaintext").
+			Find(&rows).Error
+		if err != nil {
+			return updated, err
+		}
+
+		for _, row := range rows {
+			err := r.db.Model(table.model).Where("id = ? AND legacy_plaintext", row.ID).
+				Updates(map[string]interface{}{table.column: hash(row.Value), "legacy_plaintext": false}).Error
+			if err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+
+	// КОДЫ ВОССТАНОВЛЕНИЯ УЖЕ ХРАНЯТСЯ КАК sha256, КЛЮЧ НАКЛАДЫВАЕТСЯ ПОВЕРХ НЕГО
+	var codes []models.RecoveryCode
+	if err := r.db.Where("NOT keyed").Find(&codes).Error; err != nil {
+		return updated, err
+	}
+	for _, code := range codes {
+		err := r.db.Model(&models.RecoveryCode{}).Where("id = ? AND NOT keyed", code.ID).
+			Updates(map[string]interface{}{"code_hash": hash(code.CodeHash), "keyed": true}).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
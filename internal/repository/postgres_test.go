@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// пул соединений без базы: в режиме DryRun gorm только строит SQL, транзакции ничего не делают
+type dryRunPool struct{}
+
+func (*dryRunPool) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, nil }
+func (*dryRunPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func (*dryRunPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+func (*dryRunPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+func (p *dryRunPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return p, nil
+}
+func (*dryRunPool) Commit() error   { return nil }
+func (*dryRunPool) Rollback() error { return nil }
+
+// запоминает SQL, который построил gorm
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// репозиторий, который не выполняет запросы, а возвращает их текст
+func dryRunRepository(t *testing.T) (*UserRepository, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: &dryRunPool{}}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               recorder,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	return NewUserRepository(db), recorder
+}
+
+// проверяет, что среди запросов есть запрос с want и ни в одном нет forbidden
+func assertSQL(t *testing.T, statements []string, want []string, forbidden []string) {
+	t.Helper()
+	all := strings.Join(statements, "\n")
+	for _, fragment := range want {
+		if !strings.Contains(all, fragment) {
+			t.Fatalf("в запросах нет %q:\n%s", fragment, all)
+		}
+	}
+	for _, fragment := range forbidden {
+		if strings.Contains(all, fragment) {
+			t.Fatalf("в запросах есть %q:\n%s", fragment, all)
+		}
+	}
+}
+
+func TestUpdateTwoFactorKeepsCounters(t *testing.T) {
+	lockedUntil := time.Now().Add(time.Hour)
+	// пользователь прочитан до проверки кода: шаг TOTP и счетчики в структуре устарели
+	stale := &models.User{
+		ID:                 7,
+		TwoFactorEnabled:   true,
+		TwoFactorVerified:  true,
+		TwoFactorSecret:    "enc:v1:secret",
+		TwoFactorMethod:    "totp",
+		TOTPLastStep:       1,
+		FailedCodeAttempts: 3,
+		LockedUntil:        &lockedUntil,
+		TokenVersion:       2,
+	}
+
+	tests := []struct {
+		name string
+		user *models.User
+	}{
+		{"подключение", stale},
+		{"отключение", &models.User{ID: 7, TwoFactorEnabled: true, TwoFactorMethod: "email", TOTPLastStep: 1, FailedCodeAttempts: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, recorder := dryRunRepository(t)
+			if err := repo.UpdateTwoFactor(tt.user); err != nil {
+				t.Fatalf("UpdateTwoFactor: %v", err)
+			}
+			assertSQL(t, recorder.statements,
+				[]string{`UPDATE "users" SET`, `"two_factor_method"=`, `"two_factor_secret"=`, `WHERE id = 7`},
+				[]string{"totp_last_step", "failed_code_attempts", "failed_login_attempts", "locked_until", "token_version", "lockout_count"})
+		})
+	}
+}
+
+func TestMarkVerificationSessionAsUsed(t *testing.T) {
+	repo, recorder := dryRunRepository(t)
+
+	// без базы запрос не затрагивает строк - как если бы сессию уже закрыл параллельный запрос
+	if err := repo.MarkVerificationSessionAsUsed("link"); err != ErrVerificationSessionUsed {
+		t.Fatalf("MarkVerificationSessionAsUsed = %v, ожидали ErrVerificationSessionUsed", err)
+	}
+	assertSQL(t, recorder.statements,
+		[]string{`UPDATE "verification_sessions" SET "used"=true`, `WHERE uuid = 'link' AND used = false`}, nil)
+}
+
+func TestEnableTwoFactorKeepsCounters(t *testing.T) {
+	repo, recorder := dryRunRepository(t)
+	if err := repo.EnableTwoFactor(7); err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+	assertSQL(t, recorder.statements,
+		[]string{`"two_factor_enabled"=true`, `"two_factor_verified"=true`, `WHERE id = 7`},
+		[]string{"failed_code_attempts", "locked_until", "lockout_count", "token_version"})
+}
+
+func TestCloseEmailChangeUndoSessions(t *testing.T) {
+	repo, recorder := dryRunRepository(t)
+	if err := repo.CloseEmailChangeUndoSessions(42); err != nil {
+		t.Fatalf("CloseEmailChangeUndoSessions: %v", err)
+	}
+	// ВСЕ ССЫЛКИ ОТМЕНЫ АККАУНТА, А НЕ ТОЛЬКО ВЫДАННЫЕ НА ЕГО ТЕКУЩИЙ EMAIL
+	assertSQL(t, recorder.statements,
+		[]string{`SET "used"=true`, `WHERE user_id = 42 AND operation = 'email_change_undo' AND used = false`},
+		[]string{"email ="})
+}
+
+func TestUpdateUserNamesTouchesOnlyGivenColumns(t *testing.T) {
+	name := "Иван"
+	lastname := "Петров"
+	counters := []string{"locked_until", "token_version", "failed_login_attempts", "lockout_count", "email", "password"}
+
+	tests := []struct {
+		name      string
+		first     *string
+		last      *string
+		want      []string
+		forbidden []string
+	}{
+		{"только имя", &name, nil, []string{`"name"='Иван'`}, append([]string{"lastname"}, counters...)},
+		{"только фамилия", nil, &lastname, []string{`"lastname"='Петров'`}, append([]string{`"name"`}, counters...)},
+		{"оба поля", &name, &lastname, []string{`"name"='Иван'`, `"lastname"='Петров'`}, counters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, recorder := dryRunRepository(t)
+			if err := repo.UpdateUserNames(7, tt.first, tt.last); err != nil {
+				t.Fatalf("UpdateUserNames: %v", err)
+			}
+			assertSQL(t, recorder.statements, append(tt.want, `WHERE id = 7`), tt.forbidden)
+		})
+	}
+}
+
+func TestDeleteUserEmails(t *testing.T) {
+	repo, recorder := dryRunRepository(t)
+	if err := repo.DeleteUserEmails(&models.User{ID: 7, Email: "User@Example.com"}); err != nil {
+		t.Fatalf("DeleteUserEmails: %v", err)
+	}
+	assertSQL(t, recorder.statements,
+		[]string{
+			`SELECT email, payload FROM "verification_sessions" WHERE email = 'User@Example.com' OR user_id = 7`,
+			`DELETE FROM "email_outbox" WHERE LOWER(recipient) IN ('user@example.com')`,
+			`NOT IN (SELECT LOWER(email) FROM users WHERE id <> 7)`,
+		},
+		nil)
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"auth-service/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *UserRepository) GetUserRoleNames(userID uint) ([]string, error) {
+	var names []string
+	err := r.db.Table("roles").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+// объединение прав всех ролей пользователя
+func (r *UserRepository) GetUserPermissionNames(userID uint) ([]string, error) {
+	var names []string
+	err := r.db.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Distinct("permissions.name").
+		Order("permissions.name").
+		Pluck("permissions.name", &names).Error
+	return names, err
+}
+
+func (r *UserRepository) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := r.db.Preload("Permissions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	}).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *UserRepository) GetRoleByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error
+	return &role, err
+}
+
+func (r *UserRepository) ListPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *UserRepository) GetPermissionsByNames(names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := r.db.Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+
+// создает роль вместе с role.Permissions, права должны уже существовать
+func (r *UserRepository) CreateRole(role *models.Role) error {
+	return r.db.Omit("Permissions.*").Create(role).Error
+}
+
+func (r *UserRepository) UpdateRole(role *models.Role, permissions []models.Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).Omit("Permissions.*").Association("Permissions").Replace(permissions)
+	})
+}
+
+// назначения и связи с правами удаляются каскадом
+func (r *UserRepository) DeleteRole(roleID uint) error {
+	return r.db.Delete(&models.Role{}, roleID).Error
+}
+
+func (r *UserRepository) AssignRole(userID, roleID uint) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserRole{UserID: userID, RoleID: roleID}).Error
+}
+
+func (r *UserRepository) AssignRoleByName(userID uint, roleName string) error {
+	role, err := r.GetRoleByName(roleName)
+	if err != nil {
+		return err
+	}
+	return r.AssignRole(userID, role.ID)
+}
+
+func (r *UserRepository) RevokeRole(userID, roleID uint) error {
+	result := r.db.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&models.UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) CountRoleUsers(roleID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.UserRole{}).Where("role_id = ?", roleID).Count(&count).Error
+	return count, err
+}
+
+// после изменения прав роли access токены ее пользователей должны перевыпуститься
+func (r *UserRepository) IncrementTokenVersionForRole(roleID uint) error {
+	return r.db.Model(&models.User{}).
+		Where("id IN (?)", r.db.Model(&models.UserRole{}).Select("user_id").Where("role_id = ?", roleID)).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+}
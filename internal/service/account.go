@@ -0,0 +1,272 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/utils"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// сколько дней прежний владелец адреса может отменить смену email
+const emailChangeUndoDays = 7
+
+func (s *AuthService) UpdateProfile(userID uint, req *models.UpdateProfileRequest, client *models.ClientInfo) (*models.User, error) {
+	if _, err := s.userRepo.GetUserByID(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.userRepo.UpdateUserProfile(userID, req.Name, req.Lastname); err != nil {
+		return nil, fmt.Errorf("ошибка обновления профиля: %w", err)
+	}
+
+	s.recordEvent(client, "profile_updated", userID, nil, "")
+	return s.GetUserByID(userID)
+}
+
+// меняет пароль по текущему и завершает все сессии кроме текущей
+func (s *AuthService) ChangePassword(userID uint, currentSessionID string, req *models.ChangePasswordRequest, client *models.ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.checkCurrentPassword(user, req.CurrentPassword, "password_changed", client); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("ошибка при хешировании пароля: %w", err)
+	}
+
+	if err := s.userRepo.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		return fmt.Errorf("ошибка обновления пароля: %w", err)
+	}
+	s.recordEvent(client, "password_changed", user.ID, nil, "")
+
+	return s.RevokeOtherSessions(user.ID, currentSessionID, client)
+}
+
+// отправляет код подтверждения на новый адрес, email меняется только после ввода кода
+func (s *AuthService) RequestEmailChange(userID uint, req *models.ChangeEmailRequest, client *models.ClientInfo) (*models.RegisterResponse, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.checkCurrentPassword(user, req.Password, "email_change_requested", client); err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(req.NewEmail, user.Email) {
+		return nil, errors.New("новый email совпадает с текущим")
+	}
+	if _, err := s.userRepo.GetUserByEmail(req.NewEmail); err == nil {
+		return nil, errors.New("пользователь с таким email уже существует")
+	}
+
+	code, err := utils.GenerateTwoFactorCode()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации кода: %w", err)
+	}
+
+	session := &models.VerificationSession{
+		UUID:      uuid.New().String(),
+		Email:     user.Email,
+		CodeHash:  utils.HashToken(code),
+		Operation: "email_change",
+		Payload:   req.NewEmail,
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	}
+
+	msg, err := s.emailService.EmailChangeCodeMessage(req.NewEmail, s.emailService.Locale(user, client), code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.CreateVerificationSession(session); err != nil {
+			return fmt.Errorf("ошибка создания сессии верификации: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "email_change_requested", user.ID, nil, "")
+	return &models.RegisterResponse{
+		Message:       "Код подтверждения отправлен на новый email",
+		ActivatedLink: session.UUID,
+	}, nil
+}
+
+// меняет email по коду и отправляет на прежний адрес уведомление со ссылкой отмены
+func (s *AuthService) ConfirmEmailChange(userID uint, req *models.ConfirmEmailChangeRequest, client *models.ClientInfo) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	session, err := s.consumeAccountCode(user, req.ActivatedLink, "email_change", req.Code, "email_changed", client)
+	if err != nil {
+		return nil, err
+	}
+
+	// АДРЕС МОГЛИ ЗАНЯТЬ ПОКА ШЕЛ КОД
+	oldEmail, newEmail := user.Email, session.Payload
+	if _, err := s.userRepo.GetUserByEmail(newEmail); err == nil {
+		return nil, errors.New("пользователь с таким email уже существует")
+	}
+
+	undoToken := uuid.New().String()
+	undoSession := newEmailChangeUndoSession(user.ID, oldEmail, newEmail, undoToken)
+
+	clientURL := os.Getenv("CLIENT_URL")
+	if clientURL == "" {
+		clientURL = "http://localhost:3000"
+	}
+	undoLink := fmt.Sprintf("%s/auth/email/undo/%s/%s", clientURL, undoSession.UUID, undoToken)
+
+	msg, err := s.emailService.EmailChangedMessage(oldEmail, s.emailService.Locale(user, client), newEmail, undoLink, emailChangeUndoDays)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.MarkVerificationSessionAsUsed(session.UUID); err != nil {
+			return usedSessionError(err)
+		}
+		if err := tx.UpdateUserEmail(user.ID, newEmail); err != nil {
+			return fmt.Errorf("ошибка обновления email: %w", err)
+		}
+		if err := tx.CreateVerificationSession(undoSession); err != nil {
+			return fmt.Errorf("ошибка создания сессии отмены: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// EMAIL ЕСТЬ В ACCESS TOKEN, КЛИЕНТ ПОЛУЧИТ НОВЫЙ ЧЕРЕЗ REFRESH
+	if err := s.InvalidateUserTokens(user.ID); err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "email_changed", user.ID, nil, "")
+	return s.GetUserByID(user.ID)
+}
+
+// ссылка отмены привязана к аккаунту, а не к его текущему email: после цепочки смен A->B->C
+// ссылка, отправленная на A, по-прежнему возвращает аккаунту адрес A
+func newEmailChangeUndoSession(userID uint, oldEmail, newEmail, undoToken string) *models.VerificationSession {
+	return &models.VerificationSession{
+		UUID:      uuid.New().String(),
+		Email:     newEmail,
+		UserID:    &userID,
+		CodeHash:  utils.HashToken(undoToken),
+		Operation: "email_change_undo",
+		Payload:   oldEmail,
+		ExpiresAt: time.Now().AddDate(0, 0, emailChangeUndoDays),
+	}
+}
+
+// возвращает прежний email по ссылке из уведомления. Аккаунт считается захваченным:
+// все сессии завершаются, вход запрещен до сброса пароля, ссылка сброса уходит на прежний адрес
+func (s *AuthService) UndoEmailChange(req *models.UndoEmailChangeRequest, client *models.ClientInfo) error {
+	session, err := s.userRepo.GetPendingVerificationSession(req.ActivatedLink)
+	if err != nil || session.Operation != "email_change_undo" ||
+		subtle.ConstantTimeCompare([]byte(session.CodeHash), []byte(utils.HashToken(req.Token))) != 1 {
+		err = errors.New("невалидная или просроченная ссылка")
+		s.recordEvent(client, "email_change_reverted", 0, err, "")
+		return err
+	}
+
+	if session.UserID == nil {
+		err = errors.New("невалидная или просроченная ссылка")
+		s.recordEvent(client, "email_change_reverted", 0, err, "")
+		return err
+	}
+	user, err := s.userRepo.GetUserByID(*session.UserID)
+	if err != nil {
+		err = errors.New("аккаунт не найден")
+		s.recordEvent(client, "email_change_reverted", 0, err, "")
+		return err
+	}
+
+	oldEmail := session.Payload
+	if _, err := s.userRepo.GetUserByEmail(oldEmail); err == nil {
+		err = errors.New("прежний email уже занят другим аккаунтом")
+		s.recordEvent(client, "email_change_reverted", user.ID, err, "")
+		return err
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.MarkVerificationSessionAsUsed(session.UUID); err != nil {
+			return usedSessionError(err)
+		}
+		if err := tx.UpdateUserEmail(user.ID, oldEmail); err != nil {
+			return fmt.Errorf("ошибка обновления email: %w", err)
+		}
+		if err := tx.CloseEmailChangeUndoSessions(user.ID); err != nil {
+			return fmt.Errorf("ошибка закрытия ссылок отмены: %w", err)
+		}
+		return tx.RequirePasswordReset(user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.revokeAllSessions(user.ID); err != nil {
+		return err
+	}
+
+	user.Email = oldEmail
+	if err := s.sendResetPasswordLink(user, client); err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "email_change_reverted", user.ID, nil, "")
+	return nil
+}
+
+// проверяет код из письма для операции над аккаунтом пользователя с теми же лимитами
+// попыток и блокировкой, что и при входе. Сессия верификации после проверки остается открытой
+func (s *AuthService) consumeAccountCode(user *models.User, activatedLink, operation, code, eventType string, client *models.ClientInfo) (*models.VerificationSession, error) {
+	pending, err := s.userRepo.GetPendingVerificationSession(activatedLink)
+	if err != nil || pending.Operation != operation || pending.Email != user.Email {
+		err = errors.New("неверный или просроченный код")
+		s.recordEvent(client, eventType, user.ID, err, "")
+		return nil, err
+	}
+
+	if isLocked(user) {
+		s.recordEvent(client, eventType, user.ID, ErrAccountLocked, "")
+		return nil, ErrAccountLocked
+	}
+
+	session, err := s.userRepo.ConsumeVerificationAttempt(activatedLink, verifyMaxAttempts())
+	if err != nil {
+		err = errors.New("превышено число попыток, запросите новый код")
+		s.recordEvent(client, eventType, user.ID, err, "")
+		return nil, err
+	}
+
+	if !s.checkVerificationCode(session, user, code) {
+		return nil, s.verificationFailure(session, user, client, "неверный или просроченный код")
+	}
+
+	if err := s.userRepo.ResetFailedCodeAttempts(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика неверных кодов: %v", err)
+	}
+	return session, nil
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/utils"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrAccountDeletionScheduled = errors.New("аккаунт удален, восстановить его можно по ссылке из письма")
+
+// сколько пользователей удаляется за один проход очистки
+const purgeBatchSize = 100
+
+// сколько дней удаленный аккаунт можно восстановить
+func accountDeletionGraceDays() int {
+	return envInt("ACCOUNT_DELETION_GRACE_DAYS", 30)
+}
+
+// отправляет код подтверждения удаления на email аккаунта
+func (s *AuthService) RequestAccountDeletion(userID uint, password string, client *models.ClientInfo) (*models.RegisterResponse, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.checkCurrentPassword(user, password, "account_deletion_requested", client); err != nil {
+		return nil, err
+	}
+
+	code, err := utils.GenerateTwoFactorCode()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации кода: %w", err)
+	}
+
+	session := &models.VerificationSession{
+		UUID:      uuid.New().String(),
+		Email:     user.Email,
+		CodeHash:  utils.HashToken(code),
+		Operation: "account_delete",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	}
+
+	msg, err := s.emailService.AccountDeleteCodeMessage(user.Email, s.emailService.Locale(user, client), code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.CreateVerificationSession(session); err != nil {
+			return fmt.Errorf("ошибка создания сессии верификации: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "account_deletion_requested", user.ID, nil, "")
+	return &models.RegisterResponse{
+		Message:       "Код подтверждения удаления отправлен на email",
+		ActivatedLink: session.UUID,
+	}, nil
+}
+
+// удаляет аккаунт по коду из письма, возвращает время безвозвратного удаления
+func (s *AuthService) ConfirmAccountDeletion(userID uint, req *models.ConfirmAccountDeletionRequest, client *models.ClientInfo) (time.Time, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return time.Time{}, ErrUserNotFound
+	}
+
+	session, err := s.consumeAccountCode(user, req.ActivatedLink, "account_delete", req.Code, "account_deletion_scheduled", client)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := s.userRepo.MarkVerificationSessionAsUsed(session.UUID); err != nil {
+		return time.Time{}, usedSessionError(err)
+	}
+
+	return s.scheduleDeletion(user, client)
+}
+
+func (s *AuthService) AdminDeleteUser(userID uint, client *models.ClientInfo) error {
+	if client != nil && client.ActorID == userID {
+		return errors.New("удалить собственный аккаунт можно только через /auth/account/delete")
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	_, err = s.scheduleDeletion(user, client)
+	return err
+}
+
+// мягкое удаление: вход запрещается, сессии завершаются, на почту уходит ссылка восстановления.
+// Безвозвратно аккаунт удаляет PurgeDeletedAccounts по истечении ACCOUNT_DELETION_GRACE_DAYS
+func (s *AuthService) scheduleDeletion(user *models.User, client *models.ClientInfo) (time.Time, error) {
+	if user.DeletionScheduledAt != nil {
+		return *user.DeletionScheduledAt, nil
+	}
+	if err := s.checkNotLastAdmin(user.ID); err != nil {
+		s.recordEvent(client, "account_deletion_scheduled", user.ID, err, "")
+		return time.Time{}, err
+	}
+
+	purgeAt := time.Now().AddDate(0, 0, accountDeletionGraceDays())
+	restoreToken := uuid.New().String()
+	restoreSession := &models.VerificationSession{
+		UUID:      uuid.New().String(),
+		Email:     user.Email,
+		CodeHash:  utils.HashToken(restoreToken),
+		Operation: "account_restore",
+		ExpiresAt: purgeAt,
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	if clientURL == "" {
+		clientURL = "http://localhost:3000"
+	}
+	restoreLink := fmt.Sprintf("%s/auth/account/restore/%s/%s", clientURL, restoreSession.UUID, restoreToken)
+
+	msg, err := s.emailService.AccountDeletionScheduledMessage(user.Email, s.emailService.Locale(user, nil), restoreLink, purgeAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.ScheduleUserDeletion(user.ID, &purgeAt); err != nil {
+			return fmt.Errorf("ошибка удаления аккаунта: %w", err)
+		}
+		if err := tx.CreateVerificationSession(restoreSession); err != nil {
+			return fmt.Errorf("ошибка создания сессии восстановления: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.revokeAllSessions(user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	s.recordEvent(client, "account_deletion_scheduled", user.ID, nil, fmt.Sprintf("purge_at=%s", purgeAt.UTC().Format(time.RFC3339)))
+	return purgeAt, nil
+}
+
+// удаление не должно оставить сервис без администратора
+func (s *AuthService) checkNotLastAdmin(userID uint) error {
+	roles, err := s.userRepo.GetUserRoleNames(userID)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки ролей: %w", err)
+	}
+	for _, name := range roles {
+		if name != "admin" {
+			continue
+		}
+		role, err := s.userRepo.GetRoleByName("admin")
+		if err != nil {
+			return fmt.Errorf("ошибка проверки администраторов: %w", err)
+		}
+		count, err := s.userRepo.CountRoleUsers(role.ID)
+		if err != nil {
+			return fmt.Errorf("ошибка проверки администраторов: %w", err)
+		}
+		if count <= 1 {
+			return errors.New("нельзя удалить последнего администратора")
+		}
+	}
+	return nil
+}
+
+// отменяет удаление по ссылке из письма
+func (s *AuthService) RestoreAccount(req *models.RestoreAccountRequest, client *models.ClientInfo) error {
+	session, err := s.userRepo.GetPendingVerificationSession(req.ActivatedLink)
+	if err != nil || session.Operation != "account_restore" ||
+		subtle.ConstantTimeCompare([]byte(session.CodeHash), []byte(utils.HashToken(req.Token))) != 1 {
+		err = errors.New("невалидная или просроченная ссылка")
+		s.recordEvent(client, "account_restored", 0, err, "")
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByEmail(session.Email)
+	if err != nil || user.DeletionScheduledAt == nil {
+		return errors.New("аккаунт не ожидает удаления")
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.ScheduleUserDeletion(user.ID, nil); err != nil {
+			return fmt.Errorf("ошибка восстановления аккаунта: %w", err)
+		}
+		if err := tx.MarkVerificationSessionAsUsed(session.UUID); err != nil {
+			return usedSessionError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "account_restored", user.ID, nil, "")
+	return nil
+}
+
+func (s *AuthService) AdminRestoreUser(userID uint, client *models.ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if user.DeletionScheduledAt == nil {
+		return errors.New("аккаунт не ожидает удаления")
+	}
+
+	if err := s.userRepo.ScheduleUserDeletion(user.ID, nil); err != nil {
+		return fmt.Errorf("ошибка восстановления аккаунта: %w", err)
+	}
+
+	s.recordEvent(client, "account_restored", user.ID, nil, "")
+	return nil
+}
+
+// все данные пользователя, которые хранит сервис
+func (s *AuthService) ExportAccount(userID uint) (*models.AccountExport, error) {
+	details, err := s.GetUserDetails(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.userRepo.GetWebAuthnCredentialsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки ключей доступа: %w", err)
+	}
+	events, err := s.userRepo.GetAllUserAuthEvents(userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки журнала аудита: %w", err)
+	}
+
+	return &models.AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    details.User,
+		TwoFactor:  details.TwoFactor,
+		Passkeys:   passkeys,
+		Sessions:   details.Sessions,
+		AuthEvents: events,
+	}, nil
+}
+
+// безвозвратно удаляет аккаунты с истекшим сроком восстановления, возвращает их число
+func (s *AuthService) PurgeDeletedAccounts() (int, error) {
+	purged := 0
+	for {
+		users, err := s.userRepo.GetUsersDueForPurge(time.Now(), purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("ошибка загрузки удаленных аккаунтов: %w", err)
+		}
+
+		for i := range users {
+			ok, err := s.userRepo.PurgeUser(&users[i])
+			if err != nil {
+				return purged, fmt.Errorf("ошибка удаления пользователя %d: %w", users[i].ID, err)
+			}
+			if !ok {
+				continue
+			}
+			s.tokenState.forgetUser(users[i].ID)
+			s.recordEvent(nil, "account_purged", users[i].ID, nil, "")
+			purged++
+		}
+
+		if len(users) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// удаляет аккаунты с истекшим сроком восстановления по расписанию, независимо от входов в сервис.
+// На нескольких репликах безопасен: PurgeUser блокирует строку пользователя
+type AccountPurgeWorker struct {
+	authService *AuthService
+	interval    time.Duration
+}
+
+// ACCOUNT_PURGE_INTERVAL_MINUTES (по умолчанию 10)
+func NewAccountPurgeWorker(authService *AuthService) *AccountPurgeWorker {
+	return &AccountPurgeWorker{
+		authService: authService,
+		interval:    time.Duration(envInt("ACCOUNT_PURGE_INTERVAL_MINUTES", 10)) * time.Minute,
+	}
+}
+
+func (w *AccountPurgeWorker) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		w.purge()
+		for range ticker.C {
+			w.purge()
+		}
+	}()
+}
+
+func (w *AccountPurgeWorker) purge() {
+	purged, err := w.authService.PurgeDeletedAccounts()
+	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	if purged > 0 {
+		log.Printf("🗑️ Безвозвратно удалено аккаунтов: %d", purged)
+	}
+}
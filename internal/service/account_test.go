@@ -0,0 +1,40 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"testing"
+)
+
+func TestEmailChangeUndoSessionChain(t *testing.T) {
+	t.Setenv("TOKEN_HASH_KEY", "test-key")
+
+	// захвативший аккаунт меняет A -> B, затем B -> C
+	const userID = 42
+	first := newEmailChangeUndoSession(userID, "a@example.com", "b@example.com", "token-a")
+	second := newEmailChangeUndoSession(userID, "b@example.com", "c@example.com", "token-b")
+
+	tests := []struct {
+		name      string
+		session   *models.VerificationSession
+		wantEmail string
+	}{
+		{"ссылка на исходный адрес A", first, "a@example.com"},
+		{"ссылка на промежуточный адрес B", second, "b@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// АККАУНТ НАХОДИТСЯ ПО user_id, ТЕКУЩИЙ EMAIL (C) НА ЭТО НЕ ВЛИЯЕТ
+			if tt.session.UserID == nil || *tt.session.UserID != userID {
+				t.Fatalf("user_id = %v, ожидали %d", tt.session.UserID, userID)
+			}
+			if tt.session.Payload != tt.wantEmail || tt.session.Operation != "email_change_undo" {
+				t.Fatalf("сессия отмены: email=%s operation=%s", tt.session.Payload, tt.session.Operation)
+			}
+		})
+	}
+
+	if first.UUID == second.UUID || first.CodeHash == second.CodeHash {
+		t.Fatal("у ссылок отмены одной цепочки должны быть разные activated_link и токены")
+	}
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrAccountDisabled = errors.New("аккаунт отключен администратором")
+
+var ErrPasswordResetRequired = errors.New("требуется сброс пароля, ссылка отправлена на почту")
+
+var ErrUserNotFound = errors.New("пользователь не найден")
+
+const (
+	usersDefaultLimit = 50
+	usersMaxLimit     = 500
+)
+
+// страница пользователей с ролями, курсор следующей страницы (0 - последняя) и общее число по фильтру
+func (s *AuthService) ListUsers(filter *models.UserFilter) ([]models.User, uint, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = usersDefaultLimit
+	}
+	if filter.Limit > usersMaxLimit {
+		filter.Limit = usersMaxLimit
+	}
+
+	users, more, total, err := s.userRepo.ListUsers(filter)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("ошибка загрузки пользователей: %w", err)
+	}
+
+	ids := make([]uint, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	roles, err := s.userRepo.GetRoleNamesByUserIDs(ids)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("ошибка загрузки ролей: %w", err)
+	}
+	for i := range users {
+		users[i].Roles = roles[users[i].ID]
+	}
+
+	var next uint
+	if more {
+		next = users[len(users)-1].ID
+	}
+	return users, next, total, nil
+}
+
+// пользователь с ролями, состоянием 2FA и активными сессиями
+func (s *AuthService) GetUserDetails(userID uint) (*models.AdminUserResponse, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	recoveryCodes, err := s.userRepo.CountUnusedRecoveryCodes(userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета кодов восстановления: %w", err)
+	}
+	credentials, err := s.userRepo.GetWebAuthnCredentialsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки ключей доступа: %w", err)
+	}
+	sessions, err := s.ListSessions(userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AdminUserResponse{
+		User: user,
+		TwoFactor: models.AdminTwoFactorState{
+			Method:                 user.TwoFactorMethod,
+			Enabled:                user.TwoFactorEnabled,
+			RecoveryCodesRemaining: recoveryCodes,
+			Passkeys:               len(credentials),
+		},
+		Sessions: sessions,
+	}, nil
+}
+
+// меняет имя, фамилию, email и роли. Email и роли попадают в токены, поэтому после их смены токены отзываются
+func (s *AuthService) AdminUpdateUser(userID uint, req *models.AdminUpdateUserRequest, client *models.ClientInfo) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	changes := []string{}
+	invalidate := false
+
+	// ПИШЕМ ТОЛЬКО ИЗМЕНЕННЫЕ ПОЛЯ: БЛОКИРОВКУ, ВЕРСИЮ ТОКЕНОВ И ПРОЧЕЕ МОГЛИ ПОМЕНЯТЬ ПОСЛЕ ЧТЕНИЯ
+	var name, lastname, email *string
+	if req.Name != nil && *req.Name != user.Name {
+		name = req.Name
+		changes = append(changes, "name")
+	}
+	if req.Lastname != nil && *req.Lastname != user.Lastname {
+		lastname = req.Lastname
+		changes = append(changes, "lastname")
+	}
+	if req.Email != nil && !strings.EqualFold(*req.Email, user.Email) {
+		if _, err := s.userRepo.GetUserByEmail(*req.Email); err == nil {
+			return nil, errors.New("пользователь с таким email уже существует")
+		}
+		email = req.Email
+		changes = append(changes, "email")
+		invalidate = true
+	}
+
+	var roleIDs []uint
+	if req.Roles != nil {
+		roleIDs, err = s.resolveUserRoles(user.ID, req.Roles)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, "roles="+strings.Join(req.Roles, ","))
+		invalidate = true
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if name != nil || lastname != nil {
+			if err := tx.UpdateUserNames(user.ID, name, lastname); err != nil {
+				return fmt.Errorf("ошибка обновления пользователя: %w", err)
+			}
+		}
+		if email != nil {
+			if err := tx.UpdateUserEmail(user.ID, *email); err != nil {
+				return fmt.Errorf("ошибка обновления пользователя: %w", err)
+			}
+		}
+		if req.Roles != nil {
+			if err := tx.ReplaceUserRoles(user.ID, roleIDs); err != nil {
+				return fmt.Errorf("ошибка назначения ролей: %w", err)
+			}
+		}
+		if invalidate {
+			if err := tx.IncrementTokenVersion(user.ID); err != nil {
+				return fmt.Errorf("ошибка отзыва токенов: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if invalidate {
+		s.tokenState.forgetUser(user.ID)
+	}
+
+	s.recordEvent(client, "user_updated", user.ID, nil, strings.Join(changes, " "))
+	return s.GetUserByID(user.ID)
+}
+
+// id ролей по названиям. Роль admin нельзя снять с последнего администратора
+func (s *AuthService) resolveUserRoles(userID uint, names []string) ([]uint, error) {
+	ids := make([]uint, 0, len(names))
+	keepsAdmin := false
+	for _, name := range names {
+		role, err := s.userRepo.GetRoleByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+		}
+		if role.Name == "admin" {
+			keepsAdmin = true
+		}
+		ids = append(ids, role.ID)
+	}
+
+	if !keepsAdmin {
+		current, err := s.userRepo.GetUserRoleNames(userID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки ролей: %w", err)
+		}
+		for _, name := range current {
+			if name != "admin" {
+				continue
+			}
+			role, err := s.userRepo.GetRoleByName("admin")
+			if err != nil {
+				return nil, fmt.Errorf("ошибка проверки администраторов: %w", err)
+			}
+			count, err := s.userRepo.CountRoleUsers(role.ID)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка проверки администраторов: %w", err)
+			}
+			if count <= 1 {
+				return nil, errors.New("нельзя снять роль с последнего администратора")
+			}
+		}
+	}
+	return ids, nil
+}
+
+// отключает аккаунт и сразу завершает все его сессии
+func (s *AuthService) DisableUser(userID uint, client *models.ClientInfo) error {
+	if client != nil && client.ActorID == userID {
+		return errors.New("нельзя отключить собственный аккаунт")
+	}
+
+	now := time.Now()
+	if err := s.userRepo.SetUserDisabled(userID, &now); err != nil {
+		return ErrUserNotFound
+	}
+	if err := s.revokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "user_disabled", userID, nil, "")
+	return nil
+}
+
+func (s *AuthService) EnableUser(userID uint, client *models.ClientInfo) error {
+	if err := s.userRepo.SetUserDisabled(userID, nil); err != nil {
+		return ErrUserNotFound
+	}
+
+	s.recordEvent(client, "user_enabled", userID, nil, "")
+	return nil
+}
+
+// завершает сессии, запрещает вход до сброса пароля и отправляет ссылку сброса
+func (s *AuthService) ForcePasswordReset(userID uint, client *models.ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.userRepo.RequirePasswordReset(user.ID); err != nil {
+		return fmt.Errorf("ошибка обновления пользователя: %w", err)
+	}
+	if err := s.revokeAllSessions(user.ID); err != nil {
+		return err
+	}
+	if err := s.sendResetPasswordLink(user, client); err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "password_reset_forced", user.ID, nil, "")
+	return nil
+}
+
+func (s *AuthService) AdminResetTwoFactor(userID uint, client *models.ClientInfo) error {
+	if _, err := s.userRepo.GetUserByID(userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.userRepo.ResetTwoFactor(userID); err != nil {
+		return fmt.Errorf("ошибка сброса 2FA: %w", err)
+	}
+
+	s.recordEvent(client, "two_factor_reset", userID, nil, "")
+	return nil
+}
+
+func (s *AuthService) AdminRevokeSessions(userID uint, client *models.ClientInfo) error {
+	if _, err := s.userRepo.GetUserByID(userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.revokeAllSessions(userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "sessions_revoked", userID, nil, "scope=all")
+	return nil
+}
+
+func (s *AuthService) revokeAllSessions(userID uint) error {
+	if err := s.userRepo.DeleteAllUserSessions(userID); err != nil {
+		return fmt.Errorf("ошибка удаления сессий: %w", err)
+	}
+	return s.InvalidateUserTokens(userID)
+}
+
+// можно ли выдавать пользователю токены: аккаунт не удален, не отключен и не ждет сброса пароля
+func checkAccountUsable(user *models.User) error {
+	if user.DeletionScheduledAt != nil {
+		return ErrAccountDeletionScheduled
+	}
+	if user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return ErrPasswordResetRequired
+	}
+	return nil
+}
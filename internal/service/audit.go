@@ -0,0 +1,77 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// пишет событие в журнал auth_events. userID - чей аккаунт затронут (0 - неизвестен),
+// cause - ошибка, с которой завершилось действие, nil - успех
+func (s *AuthService) recordEvent(client *models.ClientInfo, eventType string, userID uint, cause error, details string) {
+	if err := s.userRepo.CreateAuthEvent(newAuthEvent(client, eventType, userID, cause, details)); err != nil {
+		log.Printf("⚠️ Ошибка записи в журнал аудита (%s): %v", eventType, err)
+	}
+}
+
+// email в журнал не пишется: журнал остается после удаления аккаунта. Для неизвестного email -
+// ключевой хеш: по нему видны повторные попытки, но адрес без TOKEN_HASH_KEY не восстановить
+func emailDetails(email string) string {
+	return "email_hash=" + utils.HashToken(strings.ToLower(strings.TrimSpace(email)))[:16]
+}
+
+// автор действия - аутентифицированный пользователь запроса, иначе сам владелец аккаунта
+func newAuthEvent(client *models.ClientInfo, eventType string, userID uint, cause error, details string) *models.AuthEvent {
+	event := &models.AuthEvent{
+		Type:    eventType,
+		Outcome: "success",
+		Details: details,
+	}
+	if cause != nil {
+		event.Outcome = "failure"
+		event.Details = strings.TrimSpace(fmt.Sprintf("%s error=%q", details, cause.Error()))
+	}
+	if userID != 0 {
+		target, actor := userID, userID
+		event.UserID = &target
+		event.ActorID = &actor
+	}
+	if client != nil {
+		if client.ActorID != 0 {
+			actor := client.ActorID
+			event.ActorID = &actor
+		}
+		event.IP = client.IP
+		event.UserAgent = truncate(client.UserAgent, 512)
+		event.CorrelationID = client.RequestID
+	}
+	return event
+}
+
+// страница журнала и курсор следующей страницы (0 - страниц больше нет)
+func (s *AuthService) ListAuthEvents(filter *models.AuthEventFilter) ([]models.AuthEvent, uint64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+
+	events, more, err := s.userRepo.ListAuthEvents(filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка чтения журнала: %w", err)
+	}
+
+	var next uint64
+	if more {
+		next = events[len(events)-1].ID
+	}
+	return events, next, nil
+}
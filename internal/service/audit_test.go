@@ -0,0 +1,32 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailDetails(t *testing.T) {
+	t.Setenv("TOKEN_HASH_KEY", "test-key")
+
+	tests := []struct {
+		name     string
+		a, b     string
+		wantSame bool
+	}{
+		{"тот же адрес", "user@example.com", "user@example.com", true},
+		{"регистр и пробелы не важны", "User@Example.com ", "user@example.com", true},
+		{"другой адрес", "user@example.com", "other@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := emailDetails(tt.a), emailDetails(tt.b)
+			if strings.Contains(a, "@") || strings.Contains(a, "example") {
+				t.Fatalf("emailDetails(%q) = %q содержит адрес", tt.a, a)
+			}
+			if (a == b) != tt.wantSame {
+				t.Fatalf("emailDetails: %q и %q, ожидали совпадение: %t", a, b, tt.wantSame)
+			}
+		})
+	}
+}
@@ -1,43 +1,56 @@
 package service
 
 import (
+	"auth-service/internal/mailer"
 	"auth-service/internal/models"
 	"auth-service/internal/repository"
 	"auth-service/internal/utils"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 )
 
 type AuthService struct {
 	userRepo     *repository.UserRepository
 	emailService *EmailService
+	webAuthn     *webauthn.WebAuthn
+	tokenState   *tokenStateCache
 }
 
-func NewAuthService(userRepo *repository.UserRepository) *AuthService {
+// webAuthn nil отключает вход по ключам доступа
+func NewAuthService(userRepo *repository.UserRepository, renderer *mailer.Renderer, webAuthn *webauthn.WebAuthn) *AuthService {
 	return &AuthService{
 		userRepo:     userRepo,
-		emailService: NewEmailService(),
+		emailService: NewEmailService(renderer),
+		webAuthn:     webAuthn,
+		tokenState:   newTokenStateCache(),
 	}
 }
 
 type TokensResponse struct {
 	AccessToken  string
 	RefreshToken string
+	SessionID    string // цепочка сессии, из которой выданы токены
+	Scope        string
+	ExpiresIn    time.Duration // время жизни access token
 }
 
-func (s *AuthService) Register(registerReq *models.RegisterRequest) (*models.RegisterResponse, error) {
+func (s *AuthService) Register(registerReq *models.RegisterRequest, client *models.ClientInfo) (*models.RegisterResponse, error) {
 	existingUser, err := s.userRepo.GetUserByEmail(registerReq.Email)
 	if err != nil {
 		if err.Error() != "пользователь не найден" {
 			return nil, fmt.Errorf("ошибка проверки пользователя: %w", err)
 		}
 	} else if existingUser != nil {
-		return nil, errors.New("пользователь с таким email уже существует")
+		err := errors.New("пользователь с таким email уже существует")
+		s.recordEvent(client, "register", existingUser.ID, err, "")
+		return nil, err
 	}
 
 	hashedPassword, err := utils.HashPassword(registerReq.Password)
@@ -50,12 +63,9 @@ func (s *AuthService) Register(registerReq *models.RegisterRequest) (*models.Reg
 		Lastname:     registerReq.Lastname,
 		Email:        registerReq.Email,
 		PasswordHash: hashedPassword,
-		Role:         "user",
-	}
-
-	if err := s.userRepo.CreateUser(user); err != nil {
-		return nil, fmt.Errorf("ошибка при создании пользователя: %w", err)
+		Locale:       registerReq.Locale,
 	}
+	user.Locale = s.emailService.Locale(user, client)
 
 	activatedLink := uuid.New().String()
 	code, err := utils.GenerateTwoFactorCode()
@@ -66,17 +76,35 @@ func (s *AuthService) Register(registerReq *models.RegisterRequest) (*models.Reg
 	session := &models.VerificationSession{
 		UUID:      activatedLink,
 		Email:     user.Email,
-		Code:      code,
+		CodeHash:  utils.HashToken(code),
 		Operation: "register",
 		ExpiresAt: time.Now().Add(10 * time.Minute),
 	}
 
-	if err := s.userRepo.CreateVerificationSession(session); err != nil {
-		return nil, fmt.Errorf("ошибка создания сессии верификации: %w", err)
+	// ПОЛЬЗОВАТЕЛЬ И ПИСЬМО С КОДОМ СОЗДАЮТСЯ ОДНОЙ ТРАНЗАКЦИЕЙ: БЕЗ ПИСЬМА АККАУНТ НЕ ПОДТВЕРДИТЬ.
+	// ОТПРАВЛЯЕТ ПИСЬМО OutboxWorker
+	msg, err := s.emailService.TwoFactorCodeMessage(user.Email, user.Locale, code)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.CreateUser(user); err != nil {
+			return fmt.Errorf("ошибка при создании пользователя: %w", err)
+		}
+		if err := tx.AssignRoleByName(user.ID, models.DefaultRole); err != nil {
+			return fmt.Errorf("ошибка назначения роли: %w", err)
+		}
+		if err := tx.CreateVerificationSession(session); err != nil {
+			return fmt.Errorf("ошибка создания сессии верификации: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// АСИНХРОННАЯ ОТПРАВКА - НЕ ЖДЕМ ОТВЕТА
-	s.emailService.Send2FACode(user.Email, code)
+	s.recordEvent(client, "register", user.ID, nil, "")
 
 	return &models.RegisterResponse{
 		Message:       "Код подтверждения отправлен на вашу почту",
@@ -84,17 +112,76 @@ func (s *AuthService) Register(registerReq *models.RegisterRequest) (*models.Reg
 	}, nil
 }
 
-func (s *AuthService) Login(loginReq *models.LoginRequest) (*models.LoginResponse, error) {
+func (s *AuthService) Login(loginReq *models.LoginRequest, client *models.ClientInfo) (*models.LoginResponse, error) {
+	unknownEmail := emailDetails(loginReq.Email)
+	if err := s.checkIPLoginLock(clientIP(client)); err != nil {
+		s.recordEvent(client, "login", 0, err, unknownEmail)
+		return nil, err
+	}
+
 	user, err := s.userRepo.GetUserByEmail(loginReq.Email)
 	if err != nil {
-		return nil, errors.New("неверный email или пароль")
+		err = errors.New("неверный email или пароль")
+		s.recordEvent(client, "login", 0, err, unknownEmail)
+		s.registerLoginFailure(nil, client)
+		return nil, err
+	}
+
+	// ПОКА АККАУНТ ЗАБЛОКИРОВАН, ПАРОЛЬ НЕ ПРОВЕРЯЕМ - ПЕРЕБОР БЕССМЫСЛЕН
+	if isLocked(user) {
+		s.recordEvent(client, "login", user.ID, ErrAccountLocked, "")
+		return nil, ErrAccountLocked
 	}
 
 	if !utils.CheckPasswordHash(loginReq.Password, user.PasswordHash) {
+		s.recordEvent(client, "login", user.ID, errors.New("неверный пароль"), "")
+		if s.registerLoginFailure(user, client) {
+			return nil, ErrAccountLocked
+		}
 		return nil, errors.New("неверный email или пароль")
 	}
 
+	if err := checkAccountUsable(user); err != nil {
+		s.recordEvent(client, "login", user.ID, err, "")
+		return nil, err
+	}
+
+	if err := s.userRepo.ResetLoginFailures(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика неудачных входов: %v", err)
+	}
+
+	// ВХОД ДЛЯ ПРИЛОЖЕНИЯ: ЗАПРОС АВТОРИЗАЦИИ ЗАПОМИНАЕМ В СЕССИИ ВЕРИФИКАЦИИ
+	if loginReq.AuthorizationRequest != "" {
+		if _, err := s.userRepo.GetPendingOAuthAuthorization(loginReq.AuthorizationRequest); err != nil {
+			return nil, ErrAuthorizationRequestExpired
+		}
+	}
+
 	activatedLink := uuid.New().String()
+
+	// ПОЛЬЗОВАТЕЛИ С АУТЕНТИФИКАТОРОМ ВВОДЯТ TOTP, ПИСЬМО НЕ ОТПРАВЛЯЕМ
+	if user.TwoFactorMethod == "totp" && user.TwoFactorSecret != "" {
+		session := &models.VerificationSession{
+			UUID:      activatedLink,
+			Email:     user.Email,
+			Operation: "login_totp",
+			Payload:   loginReq.AuthorizationRequest,
+			ExpiresAt: time.Now().Add(10 * time.Minute),
+		}
+
+		if err := s.userRepo.CreateVerificationSession(session); err != nil {
+			return nil, fmt.Errorf("ошибка создания сессии верификации: %w", err)
+		}
+
+		s.recordEvent(client, "login", user.ID, nil, "second_factor=totp")
+
+		return &models.LoginResponse{
+			Message:         "Введите код из приложения-аутентификатора",
+			ActivatedLink:   activatedLink,
+			TwoFactorMethod: "totp",
+		}, nil
+	}
+
 	code, err := utils.GenerateTwoFactorCode()
 	if err != nil {
 		return nil, fmt.Errorf("ошибка генерации кода: %w", err)
@@ -103,76 +190,243 @@ func (s *AuthService) Login(loginReq *models.LoginRequest) (*models.LoginRespons
 	session := &models.VerificationSession{
 		UUID:      activatedLink,
 		Email:     user.Email,
-		Code:      code,
+		CodeHash:  utils.HashToken(code),
 		Operation: "login",
+		Payload:   loginReq.AuthorizationRequest,
 		ExpiresAt: time.Now().Add(10 * time.Minute),
 	}
 
-	if err := s.userRepo.CreateVerificationSession(session); err != nil {
-		return nil, fmt.Errorf("ошибка создания сессии верификации: %w", err)
+	msg, err := s.emailService.TwoFactorCodeMessage(user.Email, s.emailService.Locale(user, client), code)
+	if err != nil {
+		return nil, err
 	}
 
-	// АСИНХРОННАЯ ОТПРАВКА - НЕ ЖДЕМ ОТВЕТА
-	s.emailService.Send2FACode(user.Email, code)
+	err = s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.CreateVerificationSession(session); err != nil {
+			return fmt.Errorf("ошибка создания сессии верификации: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "login", user.ID, nil, "second_factor=email")
 
 	return &models.LoginResponse{
-		Message:       "Код отправлен на вашу почту",
-		ActivatedLink: activatedLink,
+		Message:         "Код отправлен на вашу почту",
+		ActivatedLink:   activatedLink,
+		TwoFactorMethod: "email",
 	}, nil
 }
 
-func (s *AuthService) VerifyCode(verifyReq *models.VerifyRequest) (*models.VerifyResponse, error) {
-	session, err := s.userRepo.GetValidVerificationSession(verifyReq.ActivatedLink, verifyReq.Code)
+func (s *AuthService) VerifyCode(verifyReq *models.VerifyRequest, client *models.ClientInfo) (*models.VerifyResponse, error) {
+	pending, err := s.userRepo.GetPendingVerificationSession(verifyReq.ActivatedLink)
 	if err != nil {
-		return nil, errors.New("неверный или просроченный код")
+		err = errors.New("неверный или просроченный код")
+		s.recordEvent(client, "verify_code", 0, err, "")
+		return nil, err
 	}
+	operationDetails := fmt.Sprintf("operation=%s", pending.Operation)
 
-	user, err := s.userRepo.GetUserByEmail(session.Email)
+	// СЕССИИ СМЕНЫ EMAIL ПОДТВЕРЖДАЮТСЯ СВОИМИ ЭНДПОИНТАМИ И НЕ ДОЛЖНЫ ВЫДАВАТЬ ТОКЕНЫ
+	if pending.Operation != "register" && pending.Operation != "login" && pending.Operation != "login_totp" {
+		err = errors.New("неверный или просроченный код")
+		s.recordEvent(client, "verify_code", 0, err, operationDetails)
+		return nil, err
+	}
+
+	if verifyReq.RecoveryCode != "" && pending.Operation != "login" && pending.Operation != "login_totp" {
+		return nil, errors.New("код восстановления можно использовать только при входе")
+	}
+
+	user, err := s.userRepo.GetUserByEmail(pending.Email)
 	if err != nil {
 		return nil, errors.New("пользователь не найден")
 	}
 
+	if isLocked(user) {
+		s.recordEvent(client, "verify_code", user.ID, ErrAccountLocked, operationDetails)
+		return nil, ErrAccountLocked
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		s.recordEvent(client, "verify_code", user.ID, err, operationDetails)
+		return nil, err
+	}
+
+	// ПОПЫТКА ЗАСЧИТЫВАЕТСЯ ДО ПРОВЕРКИ КОДА, ИНАЧЕ ПАРАЛЛЕЛЬНЫЕ ЗАПРОСЫ ОБХОДЯТ ЛИМИТ
+	session, err := s.userRepo.ConsumeVerificationAttempt(verifyReq.ActivatedLink, verifyMaxAttempts())
+	if err != nil {
+		err = errors.New("превышено число попыток, запросите новый код")
+		s.recordEvent(client, "verify_code", user.ID, err, operationDetails)
+		return nil, err
+	}
+
+	var recoveryCodesRemaining *int
+	if verifyReq.RecoveryCode != "" {
+		if err := s.userRepo.UseRecoveryCode(user.ID, utils.HashRecoveryCode(verifyReq.RecoveryCode), utils.LegacyRecoveryCodeHash(verifyReq.RecoveryCode)); err != nil {
+			return nil, s.verificationFailure(session, user, client, "неверный или уже использованный код восстановления")
+		}
+		count, err := s.userRepo.CountUnusedRecoveryCodes(user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка подсчета кодов восстановления: %w", err)
+		}
+		remaining := int(count)
+		recoveryCodesRemaining = &remaining
+	} else if !s.checkVerificationCode(session, user, verifyReq.Code) {
+		return nil, s.verificationFailure(session, user, client, "неверный или просроченный код")
+	}
+
+	// СЕССИЮ ЗАКРЫВАЕМ ДО ВЫДАЧИ ТОКЕНОВ: ИЗ ПАРАЛЛЕЛЬНЫХ ЗАПРОСОВ С ВЕРНЫМ КОДОМ ПРОХОДИТ ОДИН
+	if err := s.userRepo.MarkVerificationSessionAsUsed(session.UUID); err != nil {
+		err = usedSessionError(err)
+		s.recordEvent(client, "verify_code", user.ID, err, operationDetails)
+		return nil, err
+	}
+
+	if err := s.userRepo.ResetFailedCodeAttempts(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика неверных кодов: %v", err)
+	}
+
+	// КОДЫ ВОССТАНОВЛЕНИЯ ВЫДАЕМ ОДИН РАЗ ПРИ ВКЛЮЧЕНИИ 2FA
+	var recoveryCodes []string
 	if !user.TwoFactorEnabled {
+		if err := s.userRepo.EnableTwoFactor(user.ID); err != nil {
+			return nil, fmt.Errorf("ошибка включения 2FA: %w", err)
+		}
 		user.TwoFactorEnabled = true
 		user.TwoFactorVerified = true
-		if err := s.userRepo.UpdateUser(user); err != nil {
-			return nil, fmt.Errorf("ошибка включения 2FA: %w", err)
+
+		recoveryCodes, err = s.issueRecoveryCodes(user.ID)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if err := s.userRepo.MarkVerificationSessionAsUsed(verifyReq.ActivatedLink); err != nil {
-		return nil, fmt.Errorf("ошибка при обновлении сессии: %w", err)
+	if verifyReq.RecoveryCode != "" {
+		operationDetails += " recovery_code=true"
+	}
+
+	// ВХОД ДЛЯ ПРИЛОЖЕНИЯ: ВМЕСТО ТОКЕНОВ СЕРВИСА КЛИЕНТ ПОЛУЧАЕТ АДРЕС С КОДОМ АВТОРИЗАЦИИ
+	if session.Payload != "" {
+		redirectTo, err := s.completeAuthorization(session.Payload, user, client)
+		if err != nil {
+			return nil, err
+		}
+		s.recordEvent(client, "verify_code", user.ID, nil, operationDetails)
+
+		return &models.VerifyResponse{
+			User:                   publicUser(user),
+			RecoveryCodes:          recoveryCodes,
+			RecoveryCodesRemaining: recoveryCodesRemaining,
+			RedirectTo:             redirectTo,
+		}, nil
 	}
 
-	tokens, err := s.generateTokens(user)
+	tokens, err := s.generateTokens(user, client)
 	if err != nil {
 		return nil, err
 	}
 
+	s.recordEvent(client, "verify_code", user.ID, nil, operationDetails)
+
 	return &models.VerifyResponse{
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		User: &models.User{
-			ID:                user.ID,
-			Name:              user.Name,
-			Lastname:          user.Lastname,
-			Email:             user.Email,
-			Role:              user.Role,
-			TwoFactorEnabled:  user.TwoFactorEnabled,
-			TwoFactorVerified: user.TwoFactorVerified,
-			CreatedAt:         user.CreatedAt,
-			UpdatedAt:         user.UpdatedAt,
-		},
+		AccessToken:            tokens.AccessToken,
+		RefreshToken:           tokens.RefreshToken,
+		User:                   publicUser(user),
+		RecoveryCodes:          recoveryCodes,
+		RecoveryCodesRemaining: recoveryCodesRemaining,
 	}, nil
 }
 
-func (s *AuthService) GetUserByID(userID uint) (*models.User, error) {
-	return s.userRepo.GetUserByID(userID)
+func (s *AuthService) checkVerificationCode(session *models.VerificationSession, user *models.User, code string) bool {
+	if session.Operation == "login_totp" {
+		return s.checkTOTPCode(user, code)
+	}
+	return subtle.ConstantTimeCompare([]byte(session.CodeHash), []byte(utils.HashToken(code))) == 1
 }
 
-func (s *AuthService) RefreshTokens(refreshToken string) (*TokensResponse, error) {
-	session, err := s.userRepo.GetSessionByToken(refreshToken)
+// учитывает неверный код в сессии и в аккаунте и возвращает ошибку для клиента
+func (s *AuthService) verificationFailure(session *models.VerificationSession, user *models.User, client *models.ClientInfo, message string) error {
+	s.recordEvent(client, "verify_code", user.ID, errors.New(message), fmt.Sprintf("operation=%s attempt=%d", session.Operation, session.Attempts))
+
+	locked, err := s.registerCodeFailure(user, client)
 	if err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+	if locked {
+		return ErrAccountLocked
+	}
+
+	if session.Attempts >= verifyMaxAttempts() {
+		if err := s.userRepo.MarkVerificationSessionAsUsed(session.UUID); err != nil {
+			log.Printf("⚠️ Ошибка закрытия сессии верификации: %v", err)
+		}
+		return errors.New("превышено число попыток, запросите новый код")
+	}
+
+	return errors.New(message)
+}
+
+// повторное использование сессии верификации - ошибка клиента, остальное - ошибка базы
+func usedSessionError(err error) error {
+	if errors.Is(err, repository.ErrVerificationSessionUsed) {
+		return err
+	}
+	return fmt.Errorf("ошибка при обновлении сессии: %w", err)
+}
+
+// копия пользователя только с полями, которые можно отдавать клиенту
+func publicUser(user *models.User) *models.User {
+	return &models.User{
+		ID:                user.ID,
+		Name:              user.Name,
+		Lastname:          user.Lastname,
+		Email:             user.Email,
+		Roles:             user.Roles,
+		TwoFactorEnabled:  user.TwoFactorEnabled,
+		TwoFactorVerified: user.TwoFactorVerified,
+		TwoFactorMethod:   user.TwoFactorMethod,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+	}
+}
+
+func (s *AuthService) GetUserByID(userID uint) (*models.User, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Roles, err = s.userRepo.GetUserRoleNames(user.ID); err != nil {
+		return nil, fmt.Errorf("ошибка загрузки ролей: %w", err)
+	}
+	return user, nil
+}
+
+// обменивает refresh token на новую пару, старый токен остается в цепочке как обменянный
+func (s *AuthService) RefreshTokens(refreshToken string, client *models.ClientInfo) (*TokensResponse, error) {
+	return s.rotateRefreshToken(refreshToken, "", client)
+}
+
+// обменивает refresh token на новую пару. clientID - приложение OAuth, которое предъявило токен:
+// сессию приложения обновляет только оно само, а сессии входа в сервис - только /auth/refresh
+func (s *AuthService) rotateRefreshToken(refreshToken, clientID string, client *models.ClientInfo) (*TokensResponse, error) {
+	session, err := s.userRepo.GetAnySessionByToken(utils.HashToken(refreshToken))
+	if err != nil || session.ClientID != clientID {
+		err = errors.New("невалидный refresh token")
+		s.recordEvent(client, "token_refresh", 0, err, "")
+		return nil, err
+	}
+
+	// ПОВТОРНОЕ ИСПОЛЬЗОВАНИЕ ОБМЕНЯННОГО ТОКЕНА - ПРИЗНАК КРАЖИ, ОТЗЫВАЕМ ВСЮ ЦЕПОЧКУ
+	if session.RotatedAt != nil {
+		s.revokeReusedFamily(session, client)
+		return nil, errors.New("невалидный refresh token")
+	}
+
+	if err := s.userRepo.MarkSessionRotated(session.ID); err != nil {
+		s.revokeReusedFamily(session, client)
 		return nil, errors.New("невалидный refresh token")
 	}
 
@@ -181,56 +435,121 @@ func (s *AuthService) RefreshTokens(refreshToken string) (*TokensResponse, error
 		return nil, errors.New("пользователь не найден")
 	}
 
-	if err := s.userRepo.DeleteSession(refreshToken); err != nil {
-		return nil, fmt.Errorf("ошибка удаления сессии: %w", err)
+	if err := checkAccountUsable(user); err != nil {
+		s.recordEvent(client, "token_refresh", user.ID, err, "")
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(user, session, nil, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "token_refresh", user.ID, nil, fmt.Sprintf("family_id=%s", session.FamilyID))
+	return tokens, nil
+}
+
+func (s *AuthService) revokeReusedFamily(session *models.Session, client *models.ClientInfo) {
+	log.Printf("🚨 Повторное использование refresh token: user_id=%d family=%s", session.UserID, session.FamilyID)
+
+	if err := s.userRepo.DeleteSessionFamily(session.FamilyID); err != nil {
+		log.Printf("⚠️ Ошибка отзыва цепочки сессий %s: %v", session.FamilyID, err)
 	}
+	s.tokenState.revokeFamilies(session.FamilyID)
 
-	return s.generateTokens(user)
+	s.recordEvent(client, "refresh_token_reuse", session.UserID, errors.New("повторное использование refresh token"),
+		fmt.Sprintf("family_id=%s session_id=%d", session.FamilyID, session.ID))
 }
 
-func (s *AuthService) Logout(refreshToken string) error {
-	return s.userRepo.DeleteSession(refreshToken)
+// отзывает сессию refresh токена вместе со всей цепочкой ротаций, allDevices - все сессии пользователя
+func (s *AuthService) Logout(refreshToken string, allDevices bool, client *models.ClientInfo) error {
+	scopeDetails := "scope=current"
+	if allDevices {
+		scopeDetails = "scope=all"
+	}
+
+	session, err := s.userRepo.GetSessionByToken(utils.HashToken(refreshToken))
+	if err != nil {
+		err = errors.New("невалидный refresh token")
+		s.recordEvent(client, "logout", 0, err, scopeDetails)
+		return err
+	}
+
+	if allDevices {
+		if err := s.userRepo.DeleteAllUserSessions(session.UserID); err != nil {
+			return fmt.Errorf("ошибка удаления сессий: %w", err)
+		}
+		if err := s.InvalidateUserTokens(session.UserID); err != nil {
+			return err
+		}
+		s.recordEvent(client, "logout", session.UserID, nil, scopeDetails)
+		return nil
+	}
+
+	if err := s.userRepo.DeleteSessionFamily(session.FamilyID); err != nil {
+		return fmt.Errorf("ошибка удаления сессии: %w", err)
+	}
+	s.tokenState.revokeFamilies(session.FamilyID)
+	s.recordEvent(client, "logout", session.UserID, nil, fmt.Sprintf("%s family_id=%s", scopeDetails, session.FamilyID))
+	return nil
 }
 
-func (s *AuthService) RequestResetPassword(req *models.RequestResetPasswordRequest) (*models.ResetPasswordResponse, error) {
+func (s *AuthService) RequestResetPassword(req *models.RequestResetPasswordRequest, client *models.ClientInfo) (*models.ResetPasswordResponse, error) {
 	user, err := s.userRepo.GetUserByEmail(req.Email)
 	if err != nil {
+		s.recordEvent(client, "password_reset_requested", 0, errors.New("пользователь не найден"), emailDetails(req.Email))
 		// ВОЗВРАЩАЕМ УСПЕХ ДАЖЕ ЕСЛИ ПОЛЬЗОВАТЕЛЯ НЕТ (security)
 		return &models.ResetPasswordResponse{
 			Message: "Если пользователь с таким email существует, инструкции по сбросу пароля отправлены на почту",
 		}, nil
 	}
 
+	if err := s.sendResetPasswordLink(user, client); err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "password_reset_requested", user.ID, nil, "")
+
+	return &models.ResetPasswordResponse{
+		Message: "Если пользователь с таким email существует, инструкции по сбросу пароля отправлены на почту",
+	}, nil
+}
+
+// создает токен сброса и ставит в очередь письмо со ссылкой
+func (s *AuthService) sendResetPasswordLink(user *models.User, client *models.ClientInfo) error {
 	token := uuid.New().String()
 	resetToken := &models.ResetPasswordToken{
 		UserID:    user.ID,
-		Token:     token,
+		TokenHash: utils.HashToken(token),
 		ExpiresAt: time.Now().Add(1 * time.Hour),
 		Used:      false,
 	}
 
-	if err := s.userRepo.CreateResetPasswordToken(resetToken); err != nil {
-		return nil, fmt.Errorf("ошибка создания токена сброса: %w", err)
-	}
-
 	clientURL := os.Getenv("CLIENT_URL")
 	if clientURL == "" {
 		clientURL = "http://localhost:3000"
 	}
 	resetLink := fmt.Sprintf("%s/auth/reset-password/%s", clientURL, token)
 
-	// АСИНХРОННАЯ ОТПРАВКА - НЕ ЖДЕМ ОТВЕТА
-	s.emailService.SendResetPasswordEmail(user.Email, resetLink)
+	msg, err := s.emailService.ResetPasswordMessage(user.Email, s.emailService.Locale(user, client), resetLink)
+	if err != nil {
+		return err
+	}
 
-	return &models.ResetPasswordResponse{
-		Message: "Если пользователь с таким email существует, инструкции по сбросу пароля отправлены на почту",
-	}, nil
+	return s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.CreateResetPasswordToken(resetToken); err != nil {
+			return fmt.Errorf("ошибка создания токена сброса: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
 }
 
-func (s *AuthService) ResetPassword(req *models.ResetPasswordRequest) (*models.ResetPasswordResponse, error) {
-	resetToken, err := s.userRepo.GetValidResetToken(req.Token)
+func (s *AuthService) ResetPassword(req *models.ResetPasswordRequest, client *models.ClientInfo) (*models.ResetPasswordResponse, error) {
+	resetToken, err := s.userRepo.GetValidResetToken(utils.HashToken(req.Token))
 	if err != nil {
-		return nil, errors.New("невалидный или просроченный токен сброса пароля")
+		err = errors.New("невалидный или просроченный токен сброса пароля")
+		s.recordEvent(client, "password_reset", 0, err, "")
+		return nil, err
 	}
 
 	user, err := s.userRepo.GetUserByID(resetToken.UserID)
@@ -247,7 +566,7 @@ func (s *AuthService) ResetPassword(req *models.ResetPasswordRequest) (*models.R
 		return nil, fmt.Errorf("ошибка обновления пароля: %w", err)
 	}
 
-	if err := s.userRepo.MarkResetTokenAsUsed(req.Token); err != nil {
+	if err := s.userRepo.MarkResetTokenAsUsed(resetToken.TokenHash); err != nil {
 		return nil, fmt.Errorf("ошибка при обновлении токена: %w", err)
 	}
 
@@ -255,26 +574,135 @@ func (s *AuthService) ResetPassword(req *models.ResetPasswordRequest) (*models.R
 		log.Printf("⚠️ Ошибка удаления сессий пользователя: %v", err)
 	}
 
+	// СБРОС ПАРОЛЯ ПОДТВЕРЖДАЕТ ВЛАДЕНИЕ ПОЧТОЙ - СНИМАЕМ БЛОКИРОВКУ
+	if err := s.userRepo.UnlockUser(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка снятия блокировки: %v", err)
+	}
+
+	// ACCESS ТОКЕНЫ, ВЫДАННЫЕ ДО СМЕНЫ ПАРОЛЯ, ПЕРЕСТАЮТ РАБОТАТЬ СРАЗУ
+	if err := s.InvalidateUserTokens(user.ID); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+
+	s.recordEvent(client, "password_reset", user.ID, nil, "")
+
 	return &models.ResetPasswordResponse{
 		Message: "Пароль успешно изменен",
 	}, nil
 }
 
-func (s *AuthService) generateTokens(user *models.User) (*TokensResponse, error) {
-	accessToken, err := utils.GenerateToken(user.ID, user.Email, user.Role)
+// тело письма пишется в очередь зашифрованным, расшифровывает его OutboxWorker перед отправкой
+func enqueueEmail(tx *repository.UserRepository, msg *mailer.Message) error {
+	html, err := utils.EncryptEmailBody(msg.To, msg.HTML)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка генерации access token: %w", err)
+		return fmt.Errorf("ошибка шифрования письма: %w", err)
 	}
+	text, err := utils.EncryptEmailBody(msg.To, msg.Text)
+	if err != nil {
+		return fmt.Errorf("ошибка шифрования письма: %w", err)
+	}
+
+	email := &models.EmailOutbox{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		HTML:      html,
+		Text:      text,
+	}
+	if err := tx.EnqueueEmail(email); err != nil {
+		return fmt.Errorf("ошибка постановки письма в очередь: %w", err)
+	}
+	return nil
+}
 
+// выдает токены новой сессии
+func (s *AuthService) generateTokens(user *models.User, client *models.ClientInfo) (*TokensResponse, error) {
+	return s.issueTokens(user, nil, nil, client)
+}
+
+// приложение OAuth, которому выдаются токены, и разрешенный ему scope
+type oauthGrant struct {
+	Client *models.OAuthClient
+	Scope  string
+}
+
+// parent - обменянная сессия той же цепочки, nil для новой сессии. grant - приложение
+// для новой сессии из /oauth/token, при ротации приложение и scope берутся из parent.
+// Для приложения срок жизни токенов и aud берутся из его настроек
+func (s *AuthService) issueTokens(user *models.User, parent *models.Session, grant *oauthGrant, client *models.ClientInfo) (*TokensResponse, error) {
 	refreshToken, err := utils.GenerateRefreshToken()
 	if err != nil {
 		return nil, fmt.Errorf("ошибка генерации refresh token: %w", err)
 	}
 
+	var app *models.OAuthClient
+	if grant != nil {
+		app = grant.Client
+	} else if parent != nil && parent.ClientID != "" {
+		if app, err = s.userRepo.GetOAuthClient(parent.ClientID); err != nil {
+			return nil, ErrOAuthClientNotFound
+		}
+	}
+	accessTTL, refreshTTL := clientTokenLifetimes(app)
+
+	now := time.Now()
 	session := &models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		FamilyID:         uuid.New().String(),
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(refreshTTL),
+	}
+	if client != nil {
+		session.UserAgent = truncate(client.UserAgent, 512)
+		session.IP = client.IP
+		session.ClientLabel = truncate(client.Label, 100)
+	}
+	if grant != nil {
+		session.ClientID = grant.Client.ClientID
+		session.Scope = grant.Scope
+		if session.ClientLabel == "" {
+			session.ClientLabel = truncate(grant.Client.Name, 100)
+		}
+	}
+	if parent != nil {
+		session.FamilyID = parent.FamilyID
+		session.CreatedAt = parent.CreatedAt
+		session.ClientID = parent.ClientID
+		session.Scope = parent.Scope
+		if session.ClientLabel == "" {
+			session.ClientLabel = parent.ClientLabel
+		}
+	}
+
+	roles, permissions, err := s.userAccess(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.Roles = roles
+
+	claims := &utils.Claims{
 		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
+		Email:        user.Email,
+		SessionID:    session.FamilyID,
+		TokenVersion: user.TokenVersion,
+		ClientID:     session.ClientID,
+		Scope:        session.Scope,
+		SubjectType:  utils.SubjectUser,
+	}
+	// РОЛИ И ПРАВА ТОЛЬКО В ТОКЕНАХ САМОГО СЕРВИСА: ПРИЛОЖЕНИЮ ПОЛЬЗОВАТЕЛЬ ДОВЕРИЛ ЛИШЬ SCOPE
+	if session.ClientID == "" {
+		claims.Roles = roles
+		claims.Permissions = permissions
+	} else {
+		clientTokenIdentity(claims, user, session.Scope)
+	}
+	var audience []string
+	if app != nil {
+		audience = clientAudiences(app)
+	}
+	accessToken, err := utils.GenerateTokenWithTTL(claims, accessTTL, audience)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации access token: %w", err)
 	}
 
 	if err := s.userRepo.CreateSession(session); err != nil {
@@ -286,12 +714,27 @@ func (s *AuthService) generateTokens(user *models.User) (*TokensResponse, error)
 	return &TokensResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
+		SessionID:    session.FamilyID,
+		Scope:        session.Scope,
+		ExpiresIn:    accessTTL,
 	}, nil
 }
 
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
+
 func (s *AuthService) cleanupExpiredData() {
 	s.userRepo.DeleteExpiredSessions()
 	s.userRepo.DeleteExpiredTwoFactorCodes()
 	s.userRepo.DeleteExpiredVerificationSessions()
 	s.userRepo.DeleteExpiredResetTokens()
+	s.userRepo.DeleteExpiredWebAuthnSessions()
+	s.userRepo.DeleteExpiredUnlockTokens()
+	s.userRepo.DeleteStaleIPLoginFailures(time.Now().Add(-24 * time.Hour))
+	s.userRepo.DeleteExpiredOAuthAuthorizations()
+	s.tokenState.prune()
 }
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// управляет набором ключей подписи JWT в базе и держит utils.KeyRing в актуальном состоянии
+type KeyService struct {
+	keyRepo *repository.KeyRepository
+}
+
+func NewKeyService(keyRepo *repository.KeyRepository) *KeyService {
+	return &KeyService{keyRepo: keyRepo}
+}
+
+// при пустой таблице создает первый активный ключ: из JWT_PRIVATE_KEY_FILE или новый
+func (s *KeyService) Init() error {
+	keys, err := s.keyRepo.ListUsableSigningKeys()
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки ключей подписи: %w", err)
+	}
+
+	if len(keys) == 0 {
+		alg := os.Getenv("JWT_SIGNING_ALG")
+		if alg == "" || alg == "HS256" {
+			alg = "RS256"
+		}
+
+		var key *utils.SigningKey
+		if keyFile := os.Getenv("JWT_PRIVATE_KEY_FILE"); keyFile != "" {
+			key, err = utils.LoadSigningKeyFile(alg, keyFile)
+		} else {
+			key, err = utils.GenerateSigningKey(alg)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка создания первого ключа подписи: %w", err)
+		}
+
+		// ДРУГАЯ РЕПЛИКА МОГЛА УСПЕТЬ СОЗДАТЬ КЛЮЧ РАНЬШЕ - ТОГДА ПРОСТО ПЕРЕЧИТЫВАЕМ
+		if err := s.storeKey(key, "active"); err != nil {
+			log.Printf("⚠️ Не удалось сохранить первый ключ подписи: %v", err)
+		} else {
+			log.Printf("🔑 Создан первый ключ подписи %s (%s)", key.ID, key.Algorithm)
+		}
+	}
+
+	return s.Reload()
+}
+
+// перечитывает ключи из базы и подменяет набор, которым подписываются и проверяются токены
+func (s *KeyService) Reload() error {
+	keys, err := s.keyRepo.ListUsableSigningKeys()
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки ключей подписи: %w", err)
+	}
+
+	var active *utils.SigningKey
+	var verifyOnly []*utils.SigningKey
+	for _, record := range keys {
+		privatePEM, err := utils.DecryptSigningKeyPEM(record.KID, record.PrivateKey)
+		if err != nil {
+			log.Printf("⚠️ Пропускаем ключ %s: %v", record.KID, err)
+			continue
+		}
+		key, err := utils.ParseSigningKeyPEM(record.Algorithm, privatePEM)
+		if err != nil {
+			log.Printf("⚠️ Пропускаем ключ %s: %v", record.KID, err)
+			continue
+		}
+		if record.Status == "active" {
+			active = key
+		} else {
+			verifyOnly = append(verifyOnly, key)
+		}
+	}
+
+	if active == nil {
+		return errors.New("нет активного ключа подписи")
+	}
+
+	utils.SetKeyRing(utils.NewKeyRing(active, verifyOnly...))
+	return nil
+}
+
+// периодически перечитывает ключи, чтобы ротация из authctl дошла до всех реплик.
+// Интервал 0 или меньше отключает перечитывание
+func (s *KeyService) StartAutoReload(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("⚠️ Автообновление ключей подписи отключено, ротация применится после перезапуска")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.Reload(); err != nil {
+				log.Printf("⚠️ Ошибка обновления ключей подписи: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *KeyService) List() ([]models.SigningKey, error) {
+	return s.keyRepo.ListSigningKeys()
+}
+
+// новый ключ создается только для проверки: сначала он попадает в JWKS, потом его активируют
+func (s *KeyService) Generate(alg string) (*models.SigningKey, error) {
+	key, err := utils.GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storeKey(key, "verify_only"); err != nil {
+		return nil, err
+	}
+
+	return s.keyRepo.GetSigningKeyByKID(key.ID)
+}
+
+func (s *KeyService) Promote(kid string) error {
+	return s.keyRepo.PromoteSigningKey(kid)
+}
+
+func (s *KeyService) Retire(kid string) error {
+	return s.keyRepo.RetireSigningKey(kid)
+}
+
+func (s *KeyService) storeKey(key *utils.SigningKey, status string) error {
+	privatePEM, err := utils.EncodeSigningKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	encrypted, err := utils.EncryptSigningKeyPEM(key.ID, privatePEM)
+	if err != nil {
+		return fmt.Errorf("ошибка шифрования ключа: %w", err)
+	}
+
+	record := &models.SigningKey{
+		KID:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: encrypted,
+		Status:     status,
+	}
+	if status == "active" {
+		now := time.Now()
+		record.ActivatedAt = &now
+	}
+
+	if err := s.keyRepo.CreateSigningKey(record); err != nil {
+		return fmt.Errorf("ошибка сохранения ключа: %w", err)
+	}
+	return nil
+}
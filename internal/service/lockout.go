@@ -0,0 +1,215 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrAccountLocked = errors.New("аккаунт временно заблокирован из-за большого числа неверных попыток, ссылка для разблокировки отправлена на почту")
+
+var ErrTooManyLoginAttempts = errors.New("слишком много неудачных попыток входа с этого адреса, попробуйте позже")
+
+const ipLoginFailureWindow = 15 * time.Minute
+
+// VERIFY_MAX_ATTEMPTS - попыток ввода кода на одну сессию верификации (по умолчанию 5)
+func verifyMaxAttempts() int {
+	return envInt("VERIFY_MAX_ATTEMPTS", 5)
+}
+
+func isLocked(user *models.User) bool {
+	return user.LockedUntil != nil && user.LockedUntil.After(time.Now())
+}
+
+// длительность блокировки: ACCOUNT_LOCK_MINUTES (по умолчанию 15), удваивается с каждой
+// блокировкой подряд, но не больше ACCOUNT_LOCK_MAX_MINUTES (по умолчанию сутки)
+func lockDuration(previousLockouts int) time.Duration {
+	duration := time.Duration(envInt("ACCOUNT_LOCK_MINUTES", 15)) * time.Minute
+	maxDuration := time.Duration(envInt("ACCOUNT_LOCK_MAX_MINUTES", 24*60)) * time.Minute
+	for i := 0; i < previousLockouts && duration < maxDuration; i++ {
+		duration *= 2
+	}
+	if duration > maxDuration {
+		duration = maxDuration
+	}
+	return duration
+}
+
+// учитывает неверный код, ACCOUNT_LOCK_THRESHOLD неверных кодов подряд (по умолчанию 10) блокируют аккаунт
+func (s *AuthService) registerCodeFailure(user *models.User, client *models.ClientInfo) (bool, error) {
+	failures, err := s.userRepo.IncrementFailedCodeAttempts(user.ID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка учета попытки: %w", err)
+	}
+
+	if failures < envInt("ACCOUNT_LOCK_THRESHOLD", 10) {
+		return false, nil
+	}
+
+	if err := s.lockAccount(user, "verification_code", client); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// проверяет, не заблокирован ли IP после неудачных входов
+func (s *AuthService) checkIPLoginLock(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	failure, err := s.userRepo.GetIPLoginFailure(ip)
+	if err != nil {
+		return nil
+	}
+	if failure.LockedUntil != nil && failure.LockedUntil.After(time.Now()) {
+		return ErrTooManyLoginAttempts
+	}
+	return nil
+}
+
+// учитывает неверный пароль по IP и по аккаунту (user nil, если email не найден).
+// LOGIN_IP_LOCK_THRESHOLD ошибок с IP за 15 минут (по умолчанию 20) блокируют IP,
+// LOGIN_LOCK_THRESHOLD неверных паролей подряд (по умолчанию 5) - аккаунт
+func (s *AuthService) registerLoginFailure(user *models.User, client *models.ClientInfo) bool {
+	if client != nil && client.IP != "" {
+		failure, err := s.userRepo.RegisterIPLoginFailure(client.IP, ipLoginFailureWindow)
+		if err != nil {
+			log.Printf("⚠️ Ошибка учета неудачного входа с IP: %v", err)
+		} else if failure.Failures >= envInt("LOGIN_IP_LOCK_THRESHOLD", 20) {
+			until := time.Now().Add(lockDuration(failure.LockoutCount))
+			log.Printf("🔒 IP %s заблокирован для входа до %s", client.IP, until.Format(time.RFC3339))
+			if err := s.userRepo.LockIP(client.IP, until); err != nil {
+				log.Printf("⚠️ Ошибка блокировки IP: %v", err)
+			} else {
+				s.recordEvent(client, "ip_locked", 0, nil, fmt.Sprintf("locked_until=%s", until.Format(time.RFC3339)))
+			}
+		}
+	}
+
+	if user == nil {
+		return false
+	}
+
+	failures, err := s.userRepo.IncrementFailedLoginAttempts(user.ID)
+	if err != nil {
+		log.Printf("⚠️ Ошибка учета неверного пароля: %v", err)
+		return false
+	}
+	if failures < envInt("LOGIN_LOCK_THRESHOLD", 5) {
+		return false
+	}
+
+	if err := s.lockAccount(user, "password", client); err != nil {
+		log.Printf("⚠️ %v", err)
+		return false
+	}
+	return true
+}
+
+// пароль, которым подтверждают действие в открытой сессии, проверяется как при входе: блокировки аккаунта
+// и IP действуют, а неверный пароль идет в те же счетчики. Иначе с украденным access token пароль можно перебирать
+func (s *AuthService) checkCurrentPassword(user *models.User, password, eventType string, client *models.ClientInfo) error {
+	if err := s.checkIPLoginLock(clientIP(client)); err != nil {
+		s.recordEvent(client, eventType, user.ID, err, "")
+		return err
+	}
+	if isLocked(user) {
+		s.recordEvent(client, eventType, user.ID, ErrAccountLocked, "")
+		return ErrAccountLocked
+	}
+
+	if !utils.CheckPasswordHash(password, user.PasswordHash) {
+		err := errors.New("неверный пароль")
+		s.recordEvent(client, eventType, user.ID, err, "")
+		if s.registerLoginFailure(user, client) {
+			return ErrAccountLocked
+		}
+		return err
+	}
+
+	if err := s.userRepo.ResetLoginFailures(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика неудачных входов: %v", err)
+	}
+	return nil
+}
+
+// блокирует аккаунт, пишет событие безопасности и ставит в очередь письмо со ссылкой разблокировки.
+// reason - что привело к блокировке: password или verification_code
+func (s *AuthService) lockAccount(user *models.User, reason string, client *models.ClientInfo) error {
+	until := time.Now().Add(lockDuration(user.LockoutCount))
+	log.Printf("🔒 Аккаунт user_id=%d заблокирован до %s (%s)", user.ID, until.Format(time.RFC3339), reason)
+
+	token := uuid.New().String()
+	unlockToken := &models.AccountUnlockToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: until,
+	}
+
+	clientURL := os.Getenv("CLIENT_URL")
+	if clientURL == "" {
+		clientURL = "http://localhost:3000"
+	}
+	unlockLink := fmt.Sprintf("%s/auth/unlock/%s", clientURL, token)
+
+	msg, err := s.emailService.AccountLockedMessage(user.Email, s.emailService.Locale(user, client), unlockLink, until)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepo.WithTransaction(func(tx *repository.UserRepository) error {
+		if err := tx.LockUser(user.ID, until); err != nil {
+			return fmt.Errorf("ошибка блокировки аккаунта: %w", err)
+		}
+		if err := tx.CreateUnlockToken(unlockToken); err != nil {
+			return fmt.Errorf("ошибка создания токена разблокировки: %w", err)
+		}
+		event := newAuthEvent(client, "account_locked", user.ID, nil,
+			fmt.Sprintf("reason=%s locked_until=%s", reason, until.Format(time.RFC3339)))
+		if err := tx.CreateAuthEvent(event); err != nil {
+			return fmt.Errorf("ошибка записи в журнал аудита: %w", err)
+		}
+		return enqueueEmail(tx, msg)
+	})
+}
+
+// разблокировка по ссылке из письма
+func (s *AuthService) UnlockAccount(token string, client *models.ClientInfo) error {
+	unlockToken, err := s.userRepo.UseUnlockToken(utils.HashToken(token))
+	if err != nil {
+		err = errors.New("невалидная или просроченная ссылка разблокировки")
+		s.recordEvent(client, "account_unlocked", 0, err, "via=link")
+		return err
+	}
+
+	if err := s.userRepo.UnlockUser(unlockToken.UserID); err != nil {
+		return fmt.Errorf("ошибка разблокировки аккаунта: %w", err)
+	}
+	s.recordEvent(client, "account_unlocked", unlockToken.UserID, nil, "via=link")
+	return nil
+}
+
+// разблокировка администратором, автор события - администратор из client
+func (s *AuthService) AdminUnlockUser(userID uint, client *models.ClientInfo) error {
+	if err := s.userRepo.UnlockUser(userID); err != nil {
+		err = errors.New("пользователь не найден")
+		s.recordEvent(client, "account_unlocked", userID, err, "via=admin")
+		return err
+	}
+	s.recordEvent(client, "account_unlocked", userID, nil, "via=admin")
+	return nil
+}
+
+func clientIP(client *models.ClientInfo) string {
+	if client == nil {
+		return ""
+	}
+	return client.IP
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"testing"
+	"time"
+)
+
+func TestLockDuration(t *testing.T) {
+	tests := []struct {
+		name             string
+		minutes          string
+		maxMinutes       string
+		previousLockouts int
+		want             time.Duration
+	}{
+		{"первая блокировка", "", "", 0, 15 * time.Minute},
+		{"вторая подряд удваивается", "", "", 1, 30 * time.Minute},
+		{"третья подряд", "", "", 2, time.Hour},
+		{"не больше суток по умолчанию", "", "", 10, 24 * time.Hour},
+		{"своя длительность", "10", "", 3, 80 * time.Minute},
+		{"свой потолок", "15", "60", 3, time.Hour},
+		{"потолок меньше первой блокировки", "30", "20", 0, 20 * time.Minute},
+		{"много блокировок не переполняют длительность", "", "", 1000, 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ACCOUNT_LOCK_MINUTES", tt.minutes)
+			t.Setenv("ACCOUNT_LOCK_MAX_MINUTES", tt.maxMinutes)
+			if got := lockDuration(tt.previousLockouts); got != tt.want {
+				t.Fatalf("lockDuration(%d) = %s, ожидали %s", tt.previousLockouts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsLocked(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name        string
+		lockedUntil *time.Time
+		want        bool
+	}{
+		{"не блокировался", nil, false},
+		{"блокировка истекла", &past, false},
+		{"заблокирован", &future, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLocked(&models.User{LockedUntil: tt.lockedUntil}); got != tt.want {
+				t.Fatalf("isLocked = %t, ожидали %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ошибка протокола OAuth: Code из RFC 6749 уходит приложению в поле error
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+var errInvalidClient = &OAuthError{Code: "invalid_client", Description: "неизвестный клиент или неверный секрет"}
+
+var ErrOIDCNotConfigured = errors.New("OpenID Connect не настроен: задайте OIDC_ISSUER")
+
+var ErrAuthorizationRequestExpired = errors.New("запрос авторизации не найден или истек, начните вход в приложении заново")
+
+const (
+	// сколько пользователь может входить после перехода из приложения
+	authorizationRequestTTL = 10 * time.Minute
+	// сколько живет код авторизации до обмена на токены
+	authorizationCodeTTL = time.Minute
+)
+
+// стандартные scope OpenID Connect, их получает приложение, если scopes при регистрации не заданы
+var supportedScopes = []string{"openid", "profile", "email"}
+
+func oidcConfigured() bool {
+	issuer := utils.Issuer()
+	return strings.HasPrefix(issuer, "https://") || strings.HasPrefix(issuer, "http://")
+}
+
+// документ /.well-known/openid-configuration
+func (s *AuthService) OpenIDConfiguration() (map[string]interface{}, error) {
+	if !oidcConfigured() {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	issuer := utils.Issuer()
+	return map[string]interface{}{
+		"issuer":                                        issuer,
+		"authorization_endpoint":                        issuer + "/oauth/authorize",
+		"token_endpoint":                                issuer + "/oauth/token",
+		"userinfo_endpoint":                             issuer + "/oauth/userinfo",
+		"introspection_endpoint":                        issuer + "/oauth/introspect",
+		"revocation_endpoint":                           issuer + "/oauth/revoke",
+		"jwks_uri":                                      issuer + "/.well-known/jwks.json",
+		"response_types_supported":                      []string{"code"},
+		"response_modes_supported":                      []string{"query"},
+		"grant_types_supported":                         supportedGrantTypes,
+		"subject_types_supported":                       []string{"public"},
+		"id_token_signing_alg_values_supported":         []string{utils.SigningAlgorithm()},
+		"scopes_supported":                              supportedScopes,
+		"token_endpoint_auth_methods_supported":         []string{"client_secret_basic", "client_secret_post", "none"},
+		"introspection_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"revocation_endpoint_auth_methods_supported":    []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":              []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "azp",
+			"email", "email_verified", "name", "given_name", "family_name", "locale",
+		},
+		"authorization_response_iss_parameter_supported": true,
+	}, nil
+}
+
+// проверяет запрос /oauth/authorize и возвращает адрес, куда перенаправить браузер: на страницу входа
+// или обратно в приложение с ошибкой. Ошибка функции значит, что приложению доверять нельзя
+// (неизвестный client_id или redirect_uri) и показать ее нужно пользователю
+func (s *AuthService) Authorize(req *models.AuthorizeRequest, client *models.ClientInfo) (string, error) {
+	if !oidcConfigured() {
+		return "", ErrOIDCNotConfigured
+	}
+
+	app, err := s.userRepo.GetOAuthClient(req.ClientID)
+	if err != nil {
+		return "", errors.New("неизвестный client_id")
+	}
+	if req.RedirectURI == "" || !allowsRedirectURI(app, req.RedirectURI) {
+		return "", errors.New("redirect_uri не зарегистрирован для этого приложения")
+	}
+
+	// ДАЛЬШЕ ОШИБКИ ВОЗВРАЩАЕМ ПРИЛОЖЕНИЮ НА redirect_uri
+	fail := func(code, description string) (string, error) {
+		s.recordEvent(client, "oauth_authorize", 0, errors.New(description), fmt.Sprintf("client_id=%s error=%s", app.ClientID, code))
+		return authorizationRedirect(req.RedirectURI, map[string]string{
+			"error":             code,
+			"error_description": description,
+			"state":             req.State,
+			"iss":               utils.Issuer(),
+		}), nil
+	}
+
+	if req.ResponseType != "code" {
+		return fail("unsupported_response_type", "поддерживается только response_type=code")
+	}
+	if !allowsGrantType(app, "authorization_code") {
+		return fail("unauthorized_client", "приложению не разрешен вход пользователей")
+	}
+	scope, ok := normalizeScope(req.Scope, app.Scopes)
+	if !ok {
+		return fail("invalid_scope", "scope должен содержать openid")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return fail("invalid_request", "требуется PKCE: code_challenge и code_challenge_method=S256")
+	}
+	if len(req.CodeChallenge) != 43 {
+		return fail("invalid_request", "неверный code_challenge")
+	}
+	// ОБЩЕЙ СЕССИИ БРАУЗЕРА У СЕРВИСА НЕТ, БЕЗ СТРАНИЦЫ ВХОДА ПОЛЬЗОВАТЕЛЯ НЕ УЗНАТЬ
+	if strings.Contains(" "+req.Prompt+" ", " none ") {
+		return fail("login_required", "нужен вход пользователя")
+	}
+
+	authorization := &models.OAuthAuthorization{
+		UUID:                uuid.New().String(),
+		ClientID:            app.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(authorizationRequestTTL),
+	}
+	if err := s.userRepo.CreateOAuthAuthorization(authorization); err != nil {
+		return "", fmt.Errorf("ошибка сохранения запроса авторизации: %w", err)
+	}
+
+	return authorizationRedirect(oidcLoginURL(), map[string]string{
+		"authorization_request": authorization.UUID,
+	}), nil
+}
+
+// страница входа фронтенда, она проходит обычные /auth/login и /auth/verify-email
+func oidcLoginURL() string {
+	if loginURL := os.Getenv("OIDC_LOGIN_URL"); loginURL != "" {
+		return loginURL
+	}
+	clientURL := os.Getenv("CLIENT_URL")
+	if clientURL == "" {
+		clientURL = "http://localhost:3000"
+	}
+	return clientURL + "/auth/login"
+}
+
+// данные запроса авторизации для страницы входа: какое приложение и что запрашивает
+func (s *AuthService) GetAuthorizationRequest(id string) (*models.AuthorizationRequestInfo, error) {
+	authorization, err := s.userRepo.GetPendingOAuthAuthorization(id)
+	if err != nil {
+		return nil, ErrAuthorizationRequestExpired
+	}
+
+	info := &models.AuthorizationRequestInfo{
+		AuthorizationRequest: authorization.UUID,
+		ClientID:             authorization.ClientID,
+		Scopes:               strings.Fields(authorization.Scope),
+		ExpiresAt:            authorization.ExpiresAt,
+	}
+	if app, err := s.userRepo.GetOAuthClient(authorization.ClientID); err == nil {
+		info.ClientName = app.Name
+	}
+	return info, nil
+}
+
+// выдает код авторизации вошедшему пользователю и возвращает адрес приложения с кодом
+func (s *AuthService) completeAuthorization(id string, user *models.User, client *models.ClientInfo) (string, error) {
+	authorization, err := s.userRepo.GetPendingOAuthAuthorization(id)
+	if err != nil {
+		return "", ErrAuthorizationRequestExpired
+	}
+
+	code, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", fmt.Errorf("ошибка генерации кода авторизации: %w", err)
+	}
+
+	if err := s.userRepo.AttachOAuthCode(id, user.ID, utils.HashToken(code), time.Now().Add(authorizationCodeTTL)); err != nil {
+		return "", ErrAuthorizationRequestExpired
+	}
+
+	s.recordEvent(client, "oauth_authorize", user.ID, nil, fmt.Sprintf("client_id=%s scope=%q", authorization.ClientID, authorization.Scope))
+	return authorizationRedirect(authorization.RedirectURI, map[string]string{
+		"code":  code,
+		"state": authorization.State,
+		"iss":   utils.Issuer(), // RFC 9207, защита от подмены сервера авторизации
+	}), nil
+}
+
+// /oauth/token: обмен кода авторизации или refresh token приложения
+func (s *AuthService) ExchangeToken(req *models.TokenRequest, client *models.ClientInfo) (*models.OAuthTokenResponse, error) {
+	app, err := s.authenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		s.recordEvent(client, "oauth_token", 0, err, fmt.Sprintf("client_id=%s grant_type=%s", req.ClientID, req.GrantType))
+		return nil, err
+	}
+
+	if listContains(supportedGrantTypes, req.GrantType) && !allowsGrantType(app, req.GrantType) {
+		err := &OAuthError{Code: "unauthorized_client", Description: "приложению не разрешен grant_type " + req.GrantType}
+		s.recordEvent(client, "oauth_token", 0, err, fmt.Sprintf("client_id=%s grant_type=%s", app.ClientID, req.GrantType))
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeAuthorizationCode(app, req, client)
+	case "refresh_token":
+		return s.exchangeRefreshToken(app, req, client)
+	case "client_credentials":
+		return s.exchangeClientCredentials(app, req, client)
+	}
+	return nil, &OAuthError{Code: "unsupported_grant_type", Description: "поддерживаются authorization_code, refresh_token и client_credentials"}
+}
+
+func (s *AuthService) exchangeAuthorizationCode(app *models.OAuthClient, req *models.TokenRequest, client *models.ClientInfo) (*models.OAuthTokenResponse, error) {
+	details := fmt.Sprintf("client_id=%s grant_type=authorization_code", app.ClientID)
+	invalidGrant := func(userID uint, description string) error {
+		err := &OAuthError{Code: "invalid_grant", Description: description}
+		s.recordEvent(client, "oauth_token", userID, err, details)
+		return err
+	}
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "нужны code и code_verifier"}
+	}
+
+	codeHash := utils.HashToken(req.Code)
+	authorization, err := s.userRepo.ConsumeOAuthCode(codeHash)
+	if err != nil {
+		s.revokeReusedOAuthCode(codeHash, app, client)
+		return nil, invalidGrant(0, "код авторизации невалиден, истек или уже использован")
+	}
+
+	var userID uint
+	if authorization.UserID != nil {
+		userID = *authorization.UserID
+	}
+	if authorization.ClientID != app.ClientID || authorization.RedirectURI != req.RedirectURI {
+		return nil, invalidGrant(userID, "код выдан другому приложению или для другого redirect_uri")
+	}
+	if !utils.VerifyCodeChallenge(req.CodeVerifier, authorization.CodeChallenge) {
+		return nil, invalidGrant(userID, "неверный code_verifier")
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, invalidGrant(userID, "пользователь не найден")
+	}
+	if err := checkAccountUsable(user); err != nil {
+		return nil, invalidGrant(user.ID, err.Error())
+	}
+
+	tokens, err := s.issueTokens(user, nil, &oauthGrant{Client: app, Scope: authorization.Scope}, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetOAuthAuthorizationFamily(authorization.ID, tokens.SessionID); err != nil {
+		log.Printf("⚠️ Ошибка сохранения сессии кода авторизации: %v", err)
+	}
+
+	claims := oidcClaims(user, authorization.Scope)
+	claims.Nonce = authorization.Nonce
+	if authorization.AuthTime != nil {
+		claims.AuthTime = authorization.AuthTime.Unix()
+	}
+	idToken, err := utils.GenerateIDToken(claims, oidcSubject(user), app.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации ID token: %w", err)
+	}
+
+	s.recordEvent(client, "oauth_token", user.ID, nil, details)
+	response := oauthTokenResponse(tokens)
+	response.IDToken = idToken
+	return response, nil
+}
+
+// код предъявлен повторно: по RFC 6749 отзываем токены, уже выданные по нему
+func (s *AuthService) revokeReusedOAuthCode(codeHash string, app *models.OAuthClient, client *models.ClientInfo) {
+	used, err := s.userRepo.GetUsedOAuthCode(codeHash)
+	if err != nil || used.ClientID != app.ClientID || used.FamilyID == "" {
+		return
+	}
+
+	if err := s.userRepo.DeleteSessionFamily(used.FamilyID); err != nil {
+		log.Printf("⚠️ Ошибка отзыва цепочки сессий %s: %v", used.FamilyID, err)
+	}
+	s.tokenState.revokeFamilies(used.FamilyID)
+
+	var userID uint
+	if used.UserID != nil {
+		userID = *used.UserID
+	}
+	s.recordEvent(client, "oauth_code_reuse", userID, errors.New("повторное использование кода авторизации"),
+		fmt.Sprintf("client_id=%s family_id=%s", app.ClientID, used.FamilyID))
+}
+
+func (s *AuthService) exchangeRefreshToken(app *models.OAuthClient, req *models.TokenRequest, client *models.ClientInfo) (*models.OAuthTokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "нужен refresh_token"}
+	}
+
+	tokens, err := s.rotateRefreshToken(req.RefreshToken, app.ClientID, client)
+	if err != nil {
+		return nil, &OAuthError{Code: "invalid_grant", Description: err.Error()}
+	}
+	return oauthTokenResponse(tokens), nil
+}
+
+// токен сервиса: субъект - само приложение, без пользователя, сессии и refresh token.
+// Без scope в запросе выдаются все разрешенные приложению
+func (s *AuthService) exchangeClientCredentials(app *models.OAuthClient, req *models.TokenRequest, client *models.ClientInfo) (*models.OAuthTokenResponse, error) {
+	scope := strings.Join(app.Scopes, " ")
+	if req.Scope != "" {
+		requested := uniqueValues(strings.Fields(req.Scope))
+		for _, value := range requested {
+			if !listContains(app.Scopes, value) {
+				err := &OAuthError{Code: "invalid_scope", Description: "scope не разрешен приложению: " + value}
+				s.recordEvent(client, "oauth_token", 0, err, fmt.Sprintf("client_id=%s grant_type=client_credentials", app.ClientID))
+				return nil, err
+			}
+		}
+		scope = strings.Join(requested, " ")
+	}
+
+	accessTTL, _ := clientTokenLifetimes(app)
+	accessToken, err := utils.GenerateServiceToken(app.ClientID, scope, clientAudiences(app), accessTTL)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации access token: %w", err)
+	}
+
+	s.recordEvent(client, "oauth_token", 0, nil, fmt.Sprintf("client_id=%s grant_type=client_credentials scope=%q", app.ClientID, scope))
+	return &models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(accessTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func oauthTokenResponse(tokens *TokensResponse) *models.OAuthTokenResponse {
+	return &models.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.Scope,
+	}
+}
+
+// /oauth/userinfo: данные пользователя по scope access token
+func (s *AuthService) UserInfo(userID uint, scope string) (*utils.IDTokenClaims, error) {
+	if !hasScope(scope, "openid") {
+		return nil, &OAuthError{Code: "insufficient_scope", Description: "токен выдан без scope openid"}
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	claims := oidcClaims(user, scope)
+	claims.Subject = oidcSubject(user)
+	return claims, nil
+}
+
+// sub не меняется при смене email, поэтому это id пользователя
+func oidcSubject(user *models.User) string {
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// в access token приложения тот же sub, что в id_token, а email только при выданном scope email
+func clientTokenIdentity(claims *utils.Claims, user *models.User, scope string) {
+	claims.Subject = oidcSubject(user)
+	claims.Email = ""
+	if hasScope(scope, "email") {
+		claims.Email = user.Email
+	}
+}
+
+func oidcClaims(user *models.User, scope string) *utils.IDTokenClaims {
+	claims := &utils.IDTokenClaims{}
+	if hasScope(scope, "email") {
+		verified := user.TwoFactorVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	if hasScope(scope, "profile") {
+		claims.Name = strings.TrimSpace(user.Name + " " + user.Lastname)
+		claims.GivenName = user.Name
+		claims.FamilyName = user.Lastname
+		claims.Locale = user.Locale
+	}
+	return claims
+}
+
+// scope из запроса, разрешенные приложению, без повторов. false если среди них нет openid
+func normalizeScope(scope string, allowed []string) (string, bool) {
+	requested := strings.Fields(scope)
+	result := make([]string, 0, len(allowed))
+	for _, value := range allowed {
+		if listContains(requested, value) {
+			result = append(result, value)
+		}
+	}
+	if !listContains(result, "openid") {
+		return "", false
+	}
+	return strings.Join(result, " "), true
+}
+
+func hasScope(scope, value string) bool {
+	for _, granted := range strings.Fields(scope) {
+		if granted == value {
+			return true
+		}
+	}
+	return false
+}
+
+// добавляет параметры к адресу перенаправления, пустые значения пропускаются
+func authorizationRedirect(target string, params map[string]string) string {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	query := parsed.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
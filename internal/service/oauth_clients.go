@@ -0,0 +1,340 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrOAuthClientNotFound = errors.New("приложение не найдено")
+
+// grant_type, которые можно разрешить клиенту
+var supportedGrantTypes = []string{"authorization_code", "refresh_token", "client_credentials"}
+
+// верхние границы времени жизни токенов клиента, в секундах
+const (
+	maxClientAccessTokenTTL  = 24 * 60 * 60
+	maxClientRefreshTokenTTL = 365 * 24 * 60 * 60
+)
+
+// срок refresh токена, если у клиента он не задан
+const defaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	// scope-token из RFC 6749: печатные ASCII без пробела, кавычки и обратной косой черты
+	scopeTokenPattern = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+)
+
+// проверяет запрос и собирает нового клиента, для конфиденциального возвращает его секрет.
+// Используется API администратора и authctl, клиента сохраняет вызывающий
+func NewOAuthClient(req *models.CreateOAuthClientRequest) (*models.OAuthClient, string, error) {
+	clientID := strings.TrimSpace(req.ClientID)
+	if clientID == "" {
+		clientID = uuid.New().String()
+	}
+	if !clientIDPattern.MatchString(clientID) {
+		return nil, "", errors.New("client_id может содержать только латинские буквы, цифры, точку, дефис и подчеркивание")
+	}
+
+	client := &models.OAuthClient{ClientID: clientID, Public: req.Public}
+	if err := applyOAuthClientPolicy(client, &req.UpdateOAuthClientRequest); err != nil {
+		return nil, "", err
+	}
+	if client.Public {
+		return client, "", nil
+	}
+
+	secret, err := setOAuthClientSecret(client)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// проверяет и переносит в клиента название и политику выдачи токенов
+func applyOAuthClientPolicy(client *models.OAuthClient, req *models.UpdateOAuthClientRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return errors.New("укажите название приложения")
+	}
+
+	grantTypes := uniqueValues(req.GrantTypes)
+	if len(grantTypes) == 0 {
+		grantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	for _, grantType := range grantTypes {
+		if !listContains(supportedGrantTypes, grantType) {
+			return fmt.Errorf("неподдерживаемый grant_type: %s", grantType)
+		}
+	}
+	authorizationCode := listContains(grantTypes, "authorization_code")
+	if listContains(grantTypes, "refresh_token") && !authorizationCode {
+		return errors.New("refresh_token разрешается только вместе с authorization_code")
+	}
+	// ПУБЛИЧНЫЙ КЛИЕНТ НЕ ХРАНИТ СЕКРЕТ, ЗНАЧИТ НЕ МОЖЕТ ДОКАЗАТЬ, ЧТО ОН ЭТОТ СЕРВИС
+	if listContains(grantTypes, "client_credentials") && client.Public {
+		return errors.New("client_credentials разрешается только конфиденциальным клиентам")
+	}
+
+	redirectURIs := uniqueValues(req.RedirectURIs)
+	for _, redirectURI := range redirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return err
+		}
+	}
+	if authorizationCode && len(redirectURIs) == 0 {
+		return errors.New("для authorization_code нужен хотя бы один redirect_uri")
+	}
+
+	scopes := uniqueValues(req.Scopes)
+	if len(scopes) == 0 && authorizationCode {
+		scopes = append([]string(nil), supportedScopes...)
+	}
+	for _, scope := range scopes {
+		if !scopeTokenPattern.MatchString(scope) {
+			return fmt.Errorf("недопустимый scope: %q", scope)
+		}
+	}
+	if authorizationCode && !listContains(scopes, "openid") {
+		return errors.New("приложению с authorization_code нужен scope openid")
+	}
+
+	audiences := uniqueValues(req.Audiences)
+	// С ТАКИМ aud ТОКЕН ПРИЛОЖЕНИЯ ВЫГЛЯДЕЛ БЫ КАК ТОКЕН САМОГО СЕРВИСА
+	if listContains(audiences, utils.FirstPartyAudience()) {
+		return fmt.Errorf("audience %s зарезервирован за сервисом", utils.FirstPartyAudience())
+	}
+
+	if req.IntrospectAll && client.Public {
+		return errors.New("introspect_all разрешается только конфиденциальным клиентам")
+	}
+
+	if req.AccessTokenTTL > maxClientAccessTokenTTL {
+		return fmt.Errorf("access_token_ttl не больше %d секунд", maxClientAccessTokenTTL)
+	}
+	if req.RefreshTokenTTL > maxClientRefreshTokenTTL {
+		return fmt.Errorf("refresh_token_ttl не больше %d секунд", maxClientRefreshTokenTTL)
+	}
+
+	client.Name = name
+	client.GrantTypes = grantTypes
+	client.RedirectURIs = redirectURIs
+	client.Scopes = scopes
+	client.Audiences = audiences
+	client.AccessTokenTTL = req.AccessTokenTTL
+	client.RefreshTokenTTL = req.RefreshTokenTTL
+	client.IntrospectAll = req.IntrospectAll
+	return nil
+}
+
+// redirect_uri - абсолютный адрес без фрагмента, http только для локальной разработки.
+// Схемы мобильных приложений (com.example.app:/callback) допускаются
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || parsed.Scheme == "" || strings.Contains(redirectURI, "#") {
+		return fmt.Errorf("неверный redirect_uri: %s", redirectURI)
+	}
+	switch parsed.Scheme {
+	case "https":
+		if parsed.Host == "" {
+			return fmt.Errorf("неверный redirect_uri: %s", redirectURI)
+		}
+	case "http":
+		if host := parsed.Hostname(); host != "localhost" && host != "127.0.0.1" {
+			return fmt.Errorf("redirect_uri по http разрешен только для localhost: %s", redirectURI)
+		}
+	}
+	return nil
+}
+
+// новый секрет клиента, в базе остается только его хеш
+func setOAuthClientSecret(client *models.OAuthClient) (string, error) {
+	secret, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", fmt.Errorf("ошибка генерации секрета: %w", err)
+	}
+	hash, err := utils.HashPassword(secret)
+	if err != nil {
+		return "", fmt.Errorf("ошибка хеширования секрета: %w", err)
+	}
+	client.SecretHash = hash
+	return secret, nil
+}
+
+func (s *AuthService) ListOAuthClients() ([]models.OAuthClient, error) {
+	return s.userRepo.ListOAuthClients()
+}
+
+func (s *AuthService) GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	client, err := s.userRepo.GetOAuthClient(clientID)
+	if err != nil {
+		return nil, ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+func (s *AuthService) CreateOAuthClient(req *models.CreateOAuthClientRequest, client *models.ClientInfo) (*models.OAuthClientSecretResponse, error) {
+	app, secret, err := NewOAuthClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetOAuthClient(app.ClientID); err == nil {
+		return nil, errors.New("приложение с таким client_id уже существует")
+	}
+
+	if err := s.userRepo.CreateOAuthClient(app); err != nil {
+		return nil, fmt.Errorf("ошибка создания приложения: %w", err)
+	}
+
+	s.recordEvent(client, "oauth_client_created", 0, nil, oauthClientDetails(app))
+	return &models.OAuthClientSecretResponse{Client: app, ClientSecret: secret}, nil
+}
+
+// новая политика действует для следующих выдач токенов, уже выданные токены не меняются
+func (s *AuthService) UpdateOAuthClient(clientID string, req *models.UpdateOAuthClientRequest, client *models.ClientInfo) (*models.OAuthClient, error) {
+	app, err := s.GetOAuthClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyOAuthClientPolicy(app, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.UpdateOAuthClient(app); err != nil {
+		return nil, fmt.Errorf("ошибка обновления приложения: %w", err)
+	}
+
+	s.tokenState.forgetClient(app.ClientID)
+
+	s.recordEvent(client, "oauth_client_updated", 0, nil, oauthClientDetails(app))
+	return app, nil
+}
+
+// прежний секрет перестает приниматься сразу, выданные токены остаются действительными
+func (s *AuthService) RotateOAuthClientSecret(clientID string, client *models.ClientInfo) (*models.OAuthClientSecretResponse, error) {
+	app, err := s.GetOAuthClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if app.Public {
+		return nil, errors.New("у публичного клиента нет секрета")
+	}
+
+	secret, err := setOAuthClientSecret(app)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateOAuthClient(app); err != nil {
+		return nil, fmt.Errorf("ошибка обновления приложения: %w", err)
+	}
+
+	s.recordEvent(client, "oauth_client_secret_rotated", 0, nil, fmt.Sprintf("client_id=%s", app.ClientID))
+	return &models.OAuthClientSecretResponse{Client: app, ClientSecret: secret}, nil
+}
+
+// удаляет клиента и завершает все выданные ему сессии
+func (s *AuthService) DeleteOAuthClient(clientID string, client *models.ClientInfo) error {
+	app, err := s.GetOAuthClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	families, err := s.userRepo.DeleteOAuthClient(app)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления приложения: %w", err)
+	}
+	s.tokenState.revokeFamilies(families...)
+	s.tokenState.setClient(app.ClientID, false)
+
+	s.recordEvent(client, "oauth_client_deleted", 0, nil, fmt.Sprintf("client_id=%s sessions=%d", app.ClientID, len(families)))
+	return nil
+}
+
+func oauthClientDetails(app *models.OAuthClient) string {
+	return fmt.Sprintf("client_id=%s public=%t grant_types=%s scopes=%s introspect_all=%t",
+		app.ClientID, app.Public, strings.Join(app.GrantTypes, ","), strings.Join(app.Scopes, ","), app.IntrospectAll)
+}
+
+// redirect_uri сравнивается с зарегистрированными целиком, без нормализации
+func allowsRedirectURI(client *models.OAuthClient, redirectURI string) bool {
+	return listContains(client.RedirectURIs, redirectURI)
+}
+
+func allowsGrantType(client *models.OAuthClient, grantType string) bool {
+	return listContains(client.GrantTypes, grantType)
+}
+
+// аутентификация приложения на /oauth/token: конфиденциальный клиент обязан предъявить секрет,
+// публичный не должен его присылать
+func (s *AuthService) authenticateOAuthClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+	client, err := s.userRepo.GetOAuthClient(clientID)
+	if err != nil {
+		return nil, errInvalidClient
+	}
+	if client.Public {
+		if clientSecret != "" {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	}
+	if clientSecret == "" || !utils.CheckPasswordHash(clientSecret, client.SecretHash) {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// срок жизни access и refresh токенов клиента с учетом значений по умолчанию
+func clientTokenLifetimes(client *models.OAuthClient) (time.Duration, time.Duration) {
+	accessTTL, _ := utils.GetTokenExpiration()
+	refreshTTL := defaultRefreshTokenTTL
+	if client == nil {
+		return accessTTL, refreshTTL
+	}
+	if client.AccessTokenTTL > 0 {
+		accessTTL = time.Duration(client.AccessTokenTTL) * time.Second
+	}
+	if client.RefreshTokenTTL > 0 {
+		refreshTTL = time.Duration(client.RefreshTokenTTL) * time.Second
+	}
+	return accessTTL, refreshTTL
+}
+
+// aud access токенов клиента: зарегистрированные audiences или сам client_id
+func clientAudiences(client *models.OAuthClient) []string {
+	if len(client.Audiences) > 0 {
+		return client.Audiences
+	}
+	return []string{client.ClientID}
+}
+
+// значения без пробелов по краям, пустых и повторов, в исходном порядке
+func uniqueValues(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !listContains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func listContains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+)
+
+// порядок проверки токена: сначала тип из token_type_hint, неизвестная подсказка игнорируется
+func tokenTypesByHint(hint string) []string {
+	if hint == "refresh_token" {
+		return []string{"refresh_token", "access_token"}
+	}
+	return []string{"access_token", "refresh_token"}
+}
+
+// /oauth/introspect: состояние access или refresh токена с учетом отзыва сессий.
+// Спрашивать могут только конфиденциальные клиенты и только о своих токенах (см. canIntrospect),
+// refresh token - только приложение, которому он выдан
+func (s *AuthService) IntrospectToken(req *models.IntrospectRequest) (*models.IntrospectionResponse, error) {
+	app, err := s.authenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if app.Public {
+		return nil, &OAuthError{Code: "unauthorized_client", Description: "интроспекция доступна только конфиденциальным клиентам"}
+	}
+	if req.Token == "" {
+		return nil, &OAuthError{Code: "invalid_request", Description: "нужен token"}
+	}
+
+	for _, tokenType := range tokenTypesByHint(req.TokenTypeHint) {
+		var response *models.IntrospectionResponse
+		if tokenType == "access_token" {
+			response = s.introspectAccessToken(req.Token, app)
+		} else {
+			response = s.introspectRefreshToken(req.Token, app)
+		}
+		if response != nil {
+			return response, nil
+		}
+	}
+	return &models.IntrospectionResponse{Active: false}, nil
+}
+
+// access token показывается приложению, которому выдан, ресурсному серверу из его aud (приложению
+// с таким client_id) или приложению с introspect_all. Токены самого сервиса - только с introspect_all
+func canIntrospect(app *models.OAuthClient, claims *utils.Claims) bool {
+	if app.IntrospectAll {
+		return true
+	}
+	if claims.ClientID != "" && claims.ClientID == app.ClientID {
+		return true
+	}
+	return app.ClientID != utils.FirstPartyAudience() && listContains(claims.Audience, app.ClientID)
+}
+
+// nil, если это не действующий access token или app о нем спрашивать нельзя
+func (s *AuthService) introspectAccessToken(token string, app *models.OAuthClient) *models.IntrospectionResponse {
+	claims, err := utils.ValidateToken(token)
+	if err != nil || !canIntrospect(app, claims) || s.CheckAccessToken(claims) != nil {
+		return nil
+	}
+
+	response := &models.IntrospectionResponse{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		TokenType:   "Bearer",
+		Subject:     claims.Subject,
+		Audience:    claims.Audience,
+		Issuer:      claims.Issuer,
+		SubjectType: claims.SubjectKind(),
+	}
+	if claims.ExpiresAt != nil {
+		response.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		response.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if !claims.IsService() {
+		setIntrospectedUser(response, claims.UserID, claims.Email, claims.Scope)
+		response.SessionID = claims.SessionID
+		response.UserID = claims.UserID
+		response.Roles = claims.Roles
+		response.Permissions = claims.Permissions
+	}
+	return response
+}
+
+// nil, если это не действующий refresh token приложения app
+func (s *AuthService) introspectRefreshToken(token string, app *models.OAuthClient) *models.IntrospectionResponse {
+	session, err := s.userRepo.GetSessionByToken(utils.HashToken(token))
+	if err != nil || session.ClientID != app.ClientID {
+		return nil
+	}
+	user, err := s.userRepo.GetUserByID(session.UserID)
+	if err != nil || checkAccountUsable(user) != nil {
+		return nil
+	}
+
+	response := &models.IntrospectionResponse{
+		Active:      true,
+		Scope:       session.Scope,
+		ClientID:    session.ClientID,
+		TokenType:   "refresh_token",
+		ExpiresAt:   session.ExpiresAt.Unix(),
+		IssuedAt:    session.LastUsedAt.Unix(),
+		Issuer:      utils.Issuer(),
+		SubjectType: utils.SubjectUser,
+		SessionID:   session.FamilyID,
+		UserID:      user.ID,
+	}
+	setIntrospectedUser(response, user.ID, user.Email, session.Scope)
+	return response
+}
+
+// sub пользователя - его id, как в id_token (oidcSubject). Email в username только при scope email
+func setIntrospectedUser(response *models.IntrospectionResponse, userID uint, email, scope string) {
+	response.Subject = oidcSubject(&models.User{ID: userID})
+	response.Username = ""
+	if hasScope(scope, "email") {
+		response.Username = email
+	}
+}
+
+// /oauth/revoke: приложение отзывает свой refresh или access token вместе со всей цепочкой сессии.
+// Чужой, неизвестный или уже отозванный токен не ошибка - по RFC 7009 ответ тот же
+func (s *AuthService) RevokeToken(req *models.RevokeRequest, client *models.ClientInfo) error {
+	app, err := s.authenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		s.recordEvent(client, "oauth_revoke", 0, err, fmt.Sprintf("client_id=%s", req.ClientID))
+		return err
+	}
+	if req.Token == "" {
+		return &OAuthError{Code: "invalid_request", Description: "нужен token"}
+	}
+
+	for _, tokenType := range tokenTypesByHint(req.TokenTypeHint) {
+		var userID uint
+		var familyID string
+		if tokenType == "access_token" {
+			claims, err := utils.ValidateToken(req.Token)
+			if err != nil || claims.ClientID != app.ClientID {
+				continue
+			}
+			// ТОКЕН СЕРВИСА НЕ ПРИВЯЗАН К СЕССИИ, ЕГО НЕЛЬЗЯ ОТОЗВАТЬ ОТДЕЛЬНО ОТ ПРИЛОЖЕНИЯ
+			if claims.IsService() {
+				return &OAuthError{Code: "unsupported_token_type", Description: "токены сервиса не отзываются, они истекают сами"}
+			}
+			userID, familyID = claims.UserID, claims.SessionID
+		} else {
+			// ОБМЕНЯННЫЙ ТОКЕН ТОЖЕ ОТЗЫВАЕТ СВОЮ ЦЕПОЧКУ
+			session, err := s.userRepo.GetAnySessionByToken(utils.HashToken(req.Token))
+			if err != nil || session.ClientID != app.ClientID {
+				continue
+			}
+			userID, familyID = session.UserID, session.FamilyID
+		}
+		if familyID == "" {
+			continue
+		}
+
+		if err := s.userRepo.DeleteSessionFamily(familyID); err != nil {
+			return fmt.Errorf("ошибка отзыва сессии: %w", err)
+		}
+		s.tokenState.revokeFamilies(familyID)
+		s.recordEvent(client, "oauth_revoke", userID, nil, fmt.Sprintf("client_id=%s family_id=%s token_type=%s", app.ClientID, familyID, tokenType))
+		return nil
+	}
+
+	s.recordEvent(client, "oauth_revoke", 0, errors.New("токен не найден или выдан другому приложению"), fmt.Sprintf("client_id=%s", app.ClientID))
+	return nil
+}
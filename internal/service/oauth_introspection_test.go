@@ -0,0 +1,73 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCanIntrospect(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+	t.Setenv("JWT_AUDIENCE", "")
+
+	crm := &models.OAuthClient{ClientID: "crm"}
+	ordersAPI := &models.OAuthClient{ClientID: "orders-api"}
+	gateway := &models.OAuthClient{ClientID: "gateway", IntrospectAll: true}
+	impostor := &models.OAuthClient{ClientID: utils.FirstPartyAudience()}
+
+	userToken := &utils.Claims{RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{utils.FirstPartyAudience()}}}
+	crmToken := &utils.Claims{ClientID: "crm", RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"crm"}}}
+	billingToken := &utils.Claims{ClientID: "billing", SubjectType: utils.SubjectService,
+		RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"orders-api"}}}
+
+	tests := []struct {
+		name   string
+		app    *models.OAuthClient
+		claims *utils.Claims
+		want   bool
+	}{
+		{"свой токен", crm, crmToken, true},
+		{"токен другого приложения", ordersAPI, crmToken, false},
+		{"ресурсный сервер из aud", ordersAPI, billingToken, true},
+		{"приложение не из aud", crm, billingToken, false},
+		{"токен самого сервиса без права", crm, userToken, false},
+		{"client_id совпадает с aud сервиса", impostor, userToken, false},
+		{"шлюз с introspect_all", gateway, userToken, true},
+		{"шлюз и токен приложения", gateway, crmToken, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canIntrospect(tt.app, tt.claims); got != tt.want {
+				t.Fatalf("canIntrospect(%s) = %t, ожидали %t", tt.app.ClientID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetIntrospectedUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		scope        string
+		wantUsername string
+	}{
+		{"токен самого сервиса", "", ""},
+		{"приложение без scope email", "openid profile", ""},
+		{"приложение со scope email", "openid email", "user@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &models.IntrospectionResponse{Active: true}
+			setIntrospectedUser(response, 42, "user@example.com", tt.scope)
+			if response.Subject != "42" {
+				t.Fatalf("sub = %q, ожидали id пользователя", response.Subject)
+			}
+			if response.Username != tt.wantUsername {
+				t.Fatalf("username = %q, ожидали %q", response.Username, tt.wantUsername)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestClientTokenIdentity(t *testing.T) {
+	key, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	utils.SetKeyRing(utils.NewKeyRing(key))
+
+	user := &models.User{ID: 42, Email: "user@example.com"}
+
+	tests := []struct {
+		name      string
+		scope     string
+		wantEmail string
+	}{
+		{"без scope email", "openid profile", ""},
+		{"со scope email", "openid email", "user@example.com"},
+		{"email как часть другого scope", "openid emails", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &utils.Claims{UserID: user.ID, Email: user.Email, ClientID: "crm", Scope: tt.scope}
+			clientTokenIdentity(claims, user, tt.scope)
+
+			token, err := utils.GenerateTokenWithTTL(claims, time.Minute, []string{"crm"})
+			if err != nil {
+				t.Fatalf("GenerateTokenWithTTL: %v", err)
+			}
+			parsed, err := utils.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if parsed.Subject != "42" {
+				t.Fatalf("sub = %q, ожидали id пользователя", parsed.Subject)
+			}
+			if parsed.Email != tt.wantEmail {
+				t.Fatalf("email = %q, ожидали %q", parsed.Email, tt.wantEmail)
+			}
+		})
+	}
+}
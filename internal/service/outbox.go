@@ -0,0 +1,137 @@
+package service
+
+import (
+	"auth-service/internal/mailer"
+	"auth-service/internal/models"
+	"auth-service/internal/repository"
+	"auth-service/internal/utils"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	outboxBatchSize  = 20
+	outboxSendLease  = 2 * time.Minute // сколько письмо считается занятым воркером
+	outboxBaseDelay  = 30 * time.Second
+	outboxMaxDelay   = time.Hour
+	outboxSentMaxAge = 7 * 24 * time.Hour
+)
+
+// доставляет письма из email_outbox, при ошибке повторяет с экспоненциальной задержкой
+type OutboxWorker struct {
+	outboxRepo   *repository.OutboxRepository
+	mailer       mailer.Mailer
+	pollInterval time.Duration
+	maxAttempts  int
+}
+
+// EMAIL_OUTBOX_POLL_SECONDS (по умолчанию 2) и EMAIL_MAX_ATTEMPTS (по умолчанию 8)
+func NewOutboxWorker(outboxRepo *repository.OutboxRepository, m mailer.Mailer) *OutboxWorker {
+	return &OutboxWorker{
+		outboxRepo:   outboxRepo,
+		mailer:       m,
+		pollInterval: time.Duration(envInt("EMAIL_OUTBOX_POLL_SECONDS", 2)) * time.Second,
+		maxAttempts:  envInt("EMAIL_MAX_ATTEMPTS", 8),
+	}
+}
+
+func envInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func (w *OutboxWorker) Start() {
+	go func() {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+		cleanup := time.NewTicker(time.Hour)
+		defer cleanup.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.processBatch()
+			case <-cleanup.C:
+				if err := w.outboxRepo.DeleteSentEmailsBefore(time.Now().Add(-outboxSentMaxAge)); err != nil {
+					log.Printf("⚠️ Ошибка очистки отправленных писем: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (w *OutboxWorker) processBatch() {
+	emails, err := w.outboxRepo.ClaimDueEmails(outboxBatchSize, outboxSendLease)
+	if err != nil {
+		log.Printf("⚠️ Ошибка выборки писем из очереди: %v", err)
+		return
+	}
+
+	for i := range emails {
+		w.deliver(&emails[i])
+	}
+}
+
+func (w *OutboxWorker) deliver(email *models.EmailOutbox) {
+	msg, err := outboxMessage(email)
+	if err == nil {
+		err = w.mailer.Send(msg)
+	}
+
+	if err == nil {
+		if err := w.outboxRepo.MarkEmailSent(email.ID); err != nil {
+			log.Printf("⚠️ Письмо %d отправлено, но статус не сохранен: %v", email.ID, err)
+		}
+		return
+	}
+
+	if email.Attempts >= w.maxAttempts {
+		log.Printf("❌ Письмо %d на %s не доставлено после %d попыток: %v", email.ID, email.Recipient, email.Attempts, err)
+		if err := w.outboxRepo.MarkEmailDead(email.ID, err.Error()); err != nil {
+			log.Printf("⚠️ Ошибка обновления письма %d: %v", email.ID, err)
+		}
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(outboxBackoff(email.Attempts))
+	log.Printf("⚠️ Ошибка отправки письма %d (попытка %d), повтор в %s: %v",
+		email.ID, email.Attempts, nextAttemptAt.Format("15:04:05"), err)
+	if err := w.outboxRepo.RescheduleEmail(email.ID, nextAttemptAt, err.Error()); err != nil {
+		log.Printf("⚠️ Ошибка обновления письма %d: %v", email.ID, err)
+	}
+}
+
+// письмо из очереди с расшифрованным телом. Ошибка расшифровки (например, не тот
+// EMAIL_ENCRYPTION_KEY) повторяется как ошибка отправки
+func outboxMessage(email *models.EmailOutbox) (*mailer.Message, error) {
+	html, err := utils.DecryptEmailBody(email.Recipient, email.HTML)
+	if err != nil {
+		return nil, err
+	}
+	text, err := utils.DecryptEmailBody(email.Recipient, email.Text)
+	if err != nil {
+		return nil, err
+	}
+	return &mailer.Message{
+		To:      email.Recipient,
+		Subject: email.Subject,
+		HTML:    html,
+		Text:    text,
+	}, nil
+}
+
+// 30с, 1м, 2м, 4м... но не больше часа
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempts && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	return delay
+}
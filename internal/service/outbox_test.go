@@ -0,0 +1,38 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"testing"
+)
+
+func TestOutboxMessage(t *testing.T) {
+	t.Setenv("EMAIL_ENCRYPTION_KEY", "test-key")
+	html, err := utils.EncryptEmailBody("user@example.com", "<p>123456</p>")
+	if err != nil {
+		t.Fatalf("EncryptEmailBody: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		email    *models.EmailOutbox
+		wantHTML string
+		wantErr  bool
+	}{
+		{"зашифрованное тело", &models.EmailOutbox{Recipient: "user@example.com", HTML: html}, "<p>123456</p>", false},
+		{"письмо до шифрования", &models.EmailOutbox{Recipient: "user@example.com", HTML: "<p>old</p>"}, "<p>old</p>", false},
+		{"тело перенесено в чужое письмо", &models.EmailOutbox{Recipient: "other@example.com", HTML: html}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := outboxMessage(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outboxMessage: err = %v, ожидали ошибку: %t", err, tt.wantErr)
+			}
+			if err == nil && (msg.HTML != tt.wantHTML || msg.To != tt.email.Recipient) {
+				t.Fatalf("outboxMessage = %+v", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrRoleNotFound = errors.New("роль не найдена")
+
+// роли и права пользователя для access токена
+func (s *AuthService) userAccess(userID uint) ([]string, []string, error) {
+	roles, err := s.userRepo.GetUserRoleNames(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка загрузки ролей: %w", err)
+	}
+	permissions, err := s.userRepo.GetUserPermissionNames(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка загрузки прав: %w", err)
+	}
+	return roles, permissions, nil
+}
+
+func (s *AuthService) ListRoles() ([]models.Role, error) {
+	return s.userRepo.ListRoles()
+}
+
+func (s *AuthService) ListPermissions() ([]models.Permission, error) {
+	return s.userRepo.ListPermissions()
+}
+
+func (s *AuthService) CreateRole(req *models.CreateRoleRequest, client *models.ClientInfo) (*models.Role, error) {
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if _, err := s.userRepo.GetRoleByName(name); err == nil {
+		return nil, errors.New("роль с таким названием уже существует")
+	}
+
+	permissions, err := s.resolvePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &models.Role{
+		Name:        name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := s.userRepo.CreateRole(role); err != nil {
+		return nil, fmt.Errorf("ошибка создания роли: %w", err)
+	}
+
+	s.recordEvent(client, "role_created", 0, nil, fmt.Sprintf("role=%s permissions=%s", role.Name, permissionNames(permissions)))
+	return role, nil
+}
+
+// заменяет права роли, access токены ее пользователей перевыпускаются через refresh
+func (s *AuthService) UpdateRole(name string, req *models.UpdateRoleRequest, client *models.ClientInfo) (*models.Role, error) {
+	role, err := s.userRepo.GetRoleByName(name)
+	if err != nil {
+		return nil, ErrRoleNotFound
+	}
+
+	permissions, err := s.resolvePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = req.Description
+	if err := s.userRepo.UpdateRole(role, permissions); err != nil {
+		return nil, fmt.Errorf("ошибка обновления роли: %w", err)
+	}
+	role.Permissions = permissions
+
+	if err := s.userRepo.IncrementTokenVersionForRole(role.ID); err != nil {
+		return nil, fmt.Errorf("ошибка отзыва токенов: %w", err)
+	}
+	s.tokenState.forgetAllUsers()
+
+	s.recordEvent(client, "role_updated", 0, nil, fmt.Sprintf("role=%s permissions=%s", role.Name, permissionNames(permissions)))
+	return role, nil
+}
+
+func (s *AuthService) DeleteRole(name string, client *models.ClientInfo) error {
+	role, err := s.userRepo.GetRoleByName(name)
+	if err != nil {
+		return ErrRoleNotFound
+	}
+	if role.System {
+		return errors.New("встроенную роль удалить нельзя")
+	}
+
+	// ТОКЕНЫ ОТЗЫВАЕМ ДО УДАЛЕНИЯ, ПОТОМ НАЗНАЧЕНИЙ УЖЕ НЕ БУДЕТ
+	if err := s.userRepo.IncrementTokenVersionForRole(role.ID); err != nil {
+		return fmt.Errorf("ошибка отзыва токенов: %w", err)
+	}
+	if err := s.userRepo.DeleteRole(role.ID); err != nil {
+		return fmt.Errorf("ошибка удаления роли: %w", err)
+	}
+	s.tokenState.forgetAllUsers()
+
+	s.recordEvent(client, "role_deleted", 0, nil, fmt.Sprintf("role=%s", role.Name))
+	return nil
+}
+
+func (s *AuthService) GetUserRoles(userID uint) ([]string, error) {
+	if _, err := s.userRepo.GetUserByID(userID); err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+	return s.userRepo.GetUserRoleNames(userID)
+}
+
+func (s *AuthService) AssignRole(userID uint, roleName string, client *models.ClientInfo) error {
+	if _, err := s.userRepo.GetUserByID(userID); err != nil {
+		return errors.New("пользователь не найден")
+	}
+	role, err := s.userRepo.GetRoleByName(roleName)
+	if err != nil {
+		return ErrRoleNotFound
+	}
+
+	if err := s.userRepo.AssignRole(userID, role.ID); err != nil {
+		return fmt.Errorf("ошибка назначения роли: %w", err)
+	}
+	if err := s.InvalidateUserTokens(userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "role_assigned", userID, nil, fmt.Sprintf("role=%s", role.Name))
+	return nil
+}
+
+func (s *AuthService) RevokeRole(userID uint, roleName string, client *models.ClientInfo) error {
+	role, err := s.userRepo.GetRoleByName(roleName)
+	if err != nil {
+		return ErrRoleNotFound
+	}
+
+	// ПОСЛЕДНЕГО АДМИНИСТРАТОРА НЕ ОСТАВЛЯЕМ БЕЗ РОЛИ, ИНАЧЕ РОЛЯМИ НЕКОМУ УПРАВЛЯТЬ
+	if role.Name == "admin" {
+		count, err := s.userRepo.CountRoleUsers(role.ID)
+		if err != nil {
+			return fmt.Errorf("ошибка проверки администраторов: %w", err)
+		}
+		if count <= 1 {
+			return errors.New("нельзя снять роль с последнего администратора")
+		}
+	}
+
+	if err := s.userRepo.RevokeRole(userID, role.ID); err != nil {
+		return errors.New("роль не назначена пользователю")
+	}
+	if err := s.InvalidateUserTokens(userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(client, "role_revoked", userID, nil, fmt.Sprintf("role=%s", role.Name))
+	return nil
+}
+
+// права по названиям, неизвестное название - ошибка
+func (s *AuthService) resolvePermissions(names []string) ([]models.Permission, error) {
+	permissions, err := s.userRepo.GetPermissionsByNames(names)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки прав: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, permission := range permissions {
+		known[permission.Name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("неизвестное право: %s", name)
+		}
+	}
+	return permissions, nil
+}
+
+func permissionNames(permissions []models.Permission) string {
+	names := make([]string, len(permissions))
+	for i, permission := range permissions {
+		names[i] = permission.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"errors"
+	"fmt"
+)
+
+// активные сессии пользователя, currentSessionID (sid из access token) помечает текущую
+func (s *AuthService) ListSessions(userID uint, currentSessionID string) ([]models.SessionInfo, error) {
+	sessions, err := s.userRepo.GetActiveUserSessions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки сессий: %w", err)
+	}
+
+	result := make([]models.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, models.SessionInfo{
+			ID:          session.FamilyID,
+			UserAgent:   session.UserAgent,
+			IP:          session.IP,
+			ClientLabel: session.ClientLabel,
+			ClientID:    session.ClientID,
+			CreatedAt:   session.CreatedAt,
+			LastUsedAt:  session.LastUsedAt,
+			ExpiresAt:   session.ExpiresAt,
+			Current:     session.FamilyID == currentSessionID,
+		})
+	}
+
+	return result, nil
+}
+
+func (s *AuthService) RevokeSession(userID uint, sessionID string, client *models.ClientInfo) error {
+	details := fmt.Sprintf("family_id=%s", sessionID)
+	if err := s.userRepo.DeleteUserSessionFamily(userID, sessionID); err != nil {
+		err = errors.New("сессия не найдена")
+		s.recordEvent(client, "session_revoked", userID, err, details)
+		return err
+	}
+	s.tokenState.revokeFamilies(sessionID)
+	s.recordEvent(client, "session_revoked", userID, nil, details)
+	return nil
+}
+
+// завершает все сессии пользователя кроме текущей
+func (s *AuthService) RevokeOtherSessions(userID uint, currentSessionID string, client *models.ClientInfo) error {
+	if currentSessionID == "" {
+		return errors.New("текущая сессия не определена")
+	}
+
+	sessions, err := s.userRepo.GetActiveUserSessions(userID)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки сессий: %w", err)
+	}
+
+	if err := s.userRepo.DeleteOtherUserSessions(userID, currentSessionID); err != nil {
+		return fmt.Errorf("ошибка удаления сессий: %w", err)
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.FamilyID != currentSessionID {
+			s.tokenState.revokeFamilies(session.FamilyID)
+			revoked++
+		}
+	}
+	s.recordEvent(client, "other_sessions_revoked", userID, nil, fmt.Sprintf("kept_family_id=%s revoked=%d", currentSessionID, revoked))
+	return nil
+}
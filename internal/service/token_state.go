@@ -0,0 +1,216 @@
+package service
+
+import (
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// кеш состояния токенов, чтобы не ходить в базу на каждый запрос.
+// сбрасывается локально при отзыве, другие реплики увидят изменения не позже чем через ttl
+type tokenStateCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	versions map[uint]cachedVersion
+	families map[string]cachedFamily
+	clients  map[string]cachedFamily // приложения, которым можно выдавать токены сервиса
+}
+
+type cachedVersion struct {
+	version   int
+	expiresAt time.Time
+}
+
+type cachedFamily struct {
+	active    bool
+	expiresAt time.Time
+}
+
+// TOKEN_STATE_CACHE_SECONDS: сколько секунд доверяем закешированному состоянию, 0 - без кеша
+func newTokenStateCache() *tokenStateCache {
+	seconds := 10
+	if value := os.Getenv("TOKEN_STATE_CACHE_SECONDS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			seconds = parsed
+		}
+	}
+
+	return &tokenStateCache{
+		ttl:      time.Duration(seconds) * time.Second,
+		versions: map[uint]cachedVersion{},
+		families: map[string]cachedFamily{},
+		clients:  map[string]cachedFamily{},
+	}
+}
+
+func (c *tokenStateCache) version(userID uint) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.versions[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return 0, false
+	}
+	return entry.version, true
+}
+
+func (c *tokenStateCache) setVersion(userID uint, version int) {
+	if c.ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions[userID] = cachedVersion{version: version, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *tokenStateCache) family(familyID string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.families[familyID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (c *tokenStateCache) setFamily(familyID string, active bool) {
+	if c.ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.families[familyID] = cachedFamily{active: active, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *tokenStateCache) forgetUser(userID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.versions, userID)
+}
+
+// версии сразу многих пользователей, например после изменения прав роли
+func (c *tokenStateCache) forgetAllUsers() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions = map[uint]cachedVersion{}
+}
+
+// для отозванных цепочек запоминаем отрицательный результат, а не просто удаляем запись
+func (c *tokenStateCache) revokeFamilies(familyIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, familyID := range familyIDs {
+		c.families[familyID] = cachedFamily{active: false, expiresAt: time.Now().Add(c.ttl)}
+	}
+}
+
+func (c *tokenStateCache) client(clientID string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.clients[clientID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (c *tokenStateCache) setClient(clientID string, active bool) {
+	if c.ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients[clientID] = cachedFamily{active: active, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *tokenStateCache) forgetClient(clientID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients, clientID)
+}
+
+// чистит устаревшие записи, вызывается из фоновой очистки
+func (c *tokenStateCache) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for userID, entry := range c.versions {
+		if now.After(entry.expiresAt) {
+			delete(c.versions, userID)
+		}
+	}
+	for familyID, entry := range c.families {
+		if now.After(entry.expiresAt) {
+			delete(c.families, familyID)
+		}
+	}
+	for clientID, entry := range c.clients {
+		if now.After(entry.expiresAt) {
+			delete(c.clients, clientID)
+		}
+	}
+}
+
+// проверяет, что сессия токена не отозвана и версия токенов пользователя не менялась
+func (s *AuthService) CheckAccessToken(claims *utils.Claims) error {
+	if claims.IsService() {
+		return s.checkServiceToken(claims)
+	}
+	if claims.SessionID == "" {
+		return errors.New("токен выдан до перехода на сессии, войдите заново")
+	}
+
+	version, ok := s.tokenState.version(claims.UserID)
+	if !ok {
+		var err error
+		version, err = s.userRepo.GetUserTokenVersion(claims.UserID)
+		if err != nil {
+			return errors.New("пользователь не найден")
+		}
+		s.tokenState.setVersion(claims.UserID, version)
+	}
+	if claims.TokenVersion != version {
+		return errors.New("токен отозван")
+	}
+
+	active, ok := s.tokenState.family(claims.SessionID)
+	if !ok {
+		var err error
+		active, err = s.userRepo.IsSessionFamilyActive(claims.SessionID)
+		if err != nil {
+			return fmt.Errorf("ошибка проверки сессии: %w", err)
+		}
+		s.tokenState.setFamily(claims.SessionID, active)
+	}
+	if !active {
+		return errors.New("сессия завершена")
+	}
+
+	return nil
+}
+
+// токен сервиса действует, пока приложение существует и ему разрешен client_credentials
+func (s *AuthService) checkServiceToken(claims *utils.Claims) error {
+	active, ok := s.tokenState.client(claims.ClientID)
+	if !ok {
+		app, err := s.userRepo.GetOAuthClient(claims.ClientID)
+		active = err == nil && allowsGrantType(app, "client_credentials")
+		s.tokenState.setClient(claims.ClientID, active)
+	}
+	if !active {
+		return errors.New("приложение удалено или ему запрещены токены сервиса")
+	}
+	return nil
+}
+
+// делает недействительными все выданные пользователю access токены, например после смены роли
+func (s *AuthService) InvalidateUserTokens(userID uint) error {
+	if err := s.userRepo.IncrementTokenVersion(userID); err != nil {
+		return fmt.Errorf("ошибка отзыва токенов: %w", err)
+	}
+	s.tokenState.forgetUser(userID)
+	return nil
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const recoveryCodesCount = 10
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	if name := os.Getenv("EMAIL_FROM_NAME"); name != "" {
+		return name
+	}
+	if name := os.Getenv("RESEND_FROM_NAME"); name != "" {
+		return name
+	}
+	return "Auth Service"
+}
+
+// начинает подключение приложения-аутентификатора, секрет сохраняется до подтверждения кодом
+func (s *AuthService) EnrollTOTP(userID uint, client *models.ClientInfo) (*models.TOTPEnrollResponse, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+
+	if user.TwoFactorMethod == "totp" {
+		return nil, errors.New("приложение-аутентификатор уже подключено")
+	}
+
+	secret, err := utils.GenerateTwoFactorSecret()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации секрета: %w", err)
+	}
+
+	otpAuthURL, err := utils.GenerateQRCode(secret, user.Email, totpIssuer())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации otpauth ссылки: %w", err)
+	}
+
+	qrCode, err := utils.GenerateQRCodeImage(otpAuthURL)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации QR-кода: %w", err)
+	}
+
+	encrypted, err := utils.EncryptTOTPSecret(user.ID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка шифрования секрета: %w", err)
+	}
+
+	user.TwoFactorSecret = encrypted
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения секрета: %w", err)
+	}
+	s.recordEvent(client, "totp_enroll_started", user.ID, nil, "")
+
+	return &models.TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURL: otpAuthURL,
+		QRCode:     qrCode,
+	}, nil
+}
+
+// подтверждает подключение аутентификатора и выдает новый набор кодов восстановления
+func (s *AuthService) ConfirmTOTP(userID uint, code string, client *models.ClientInfo) ([]string, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+
+	if user.TwoFactorMethod == "totp" {
+		return nil, errors.New("приложение-аутентификатор уже подключено")
+	}
+
+	if user.TwoFactorSecret == "" {
+		return nil, errors.New("сначала начните подключение приложения-аутентификатора")
+	}
+
+	if isLocked(user) {
+		s.recordEvent(client, "totp_enabled", user.ID, ErrAccountLocked, "")
+		return nil, ErrAccountLocked
+	}
+
+	if !s.checkTOTPCode(user, code) {
+		return nil, s.totpFailure(user, client, "totp_enabled")
+	}
+	if err := s.userRepo.ResetFailedCodeAttempts(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика неверных кодов: %v", err)
+	}
+
+	user.TwoFactorMethod = "totp"
+	user.TwoFactorEnabled = true
+	user.TwoFactorVerified = true
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return nil, fmt.Errorf("ошибка включения TOTP: %w", err)
+	}
+	s.recordEvent(client, "totp_enabled", user.ID, nil, "")
+
+	return s.issueRecoveryCodes(user.ID)
+}
+
+// отключает приложение-аутентификатор, дальше вход снова по коду из письма
+func (s *AuthService) DisableTOTP(userID uint, code string, client *models.ClientInfo) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return errors.New("пользователь не найден")
+	}
+
+	if user.TwoFactorMethod != "totp" {
+		return errors.New("приложение-аутентификатор не подключено")
+	}
+
+	if isLocked(user) {
+		s.recordEvent(client, "totp_disabled", user.ID, ErrAccountLocked, "")
+		return ErrAccountLocked
+	}
+
+	if !s.checkTOTPCode(user, code) {
+		return s.totpFailure(user, client, "totp_disabled")
+	}
+	if err := s.userRepo.ResetFailedCodeAttempts(user.ID); err != nil {
+		log.Printf("⚠️ Ошибка сброса счетчика неверных кодов: %v", err)
+	}
+
+	user.TwoFactorMethod = "email"
+	user.TwoFactorSecret = ""
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return fmt.Errorf("ошибка отключения TOTP: %w", err)
+	}
+
+	s.recordEvent(client, "totp_disabled", user.ID, nil, "")
+	return nil
+}
+
+// проверяет код приложения-аутентификатора и занимает его шаг: тот же код второй раз не принимается
+func (s *AuthService) checkTOTPCode(user *models.User, code string) bool {
+	secret, err := utils.DecryptTOTPSecret(user.ID, user.TwoFactorSecret)
+	if err != nil {
+		log.Printf("⚠️ Не удалось расшифровать секрет TOTP user_id=%d: %v", user.ID, err)
+		return false
+	}
+
+	step, ok := utils.ValidateTwoFactorCode(secret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return false
+	}
+	// ПАРАЛЛЕЛЬНЫЙ ЗАПРОС С ТЕМ ЖЕ КОДОМ МОГ УСПЕТЬ РАНЬШЕ - ШАГ ЗАНИМАЕТСЯ АТОМАРНО В БАЗЕ
+	if err := s.userRepo.UseTOTPStep(user.ID, step); err != nil {
+		return false
+	}
+	user.TOTPLastStep = step
+	return true
+}
+
+// неверный код приложения засчитывается в блокировку аккаунта так же, как код из письма
+func (s *AuthService) totpFailure(user *models.User, client *models.ClientInfo, eventType string) error {
+	err := errors.New("неверный код")
+	s.recordEvent(client, eventType, user.ID, err, "")
+
+	locked, lockErr := s.registerCodeFailure(user, client)
+	if lockErr != nil {
+		log.Printf("⚠️ %v", lockErr)
+	}
+	if locked {
+		return ErrAccountLocked
+	}
+	return err
+}
+
+func (s *AuthService) RegenerateRecoveryCodes(userID uint, password string, client *models.ClientInfo) ([]string, error) {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+
+	if err := s.checkCurrentPassword(user, password, "recovery_codes_regenerated", client); err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, errors.New("двухфакторная аутентификация не включена")
+	}
+
+	codes, err := s.issueRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(client, "recovery_codes_regenerated", user.ID, nil, "")
+	return codes, nil
+}
+
+// заменяет все коды восстановления пользователя, в базе хранятся только хеши
+func (s *AuthService) issueRecoveryCodes(userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка генерации кодов восстановления: %w", err)
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+
+	if err := s.userRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения кодов восстановления: %w", err)
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// адаптер models.User под интерфейс webauthn.User
+type webAuthnUser struct {
+	user        *models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return webAuthnUserHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.user.Name + " " + u.user.Lastname)
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// user handle не должен содержать персональных данных, поэтому только ID
+func webAuthnUserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// user handle из ответа аутентификатора, false если это не handle этого сервиса
+func webAuthnUserID(handle []byte) (uint, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	return uint(binary.BigEndian.Uint64(handle)), true
+}
+
+// WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME и WEBAUTHN_RP_ORIGINS (по умолчанию CLIENT_URL)
+func NewWebAuthnFromEnv() (*webauthn.WebAuthn, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+
+	rpName := os.Getenv("WEBAUTHN_RP_NAME")
+	if rpName == "" {
+		rpName = totpIssuer()
+	}
+
+	origins := os.Getenv("WEBAUTHN_RP_ORIGINS")
+	if origins == "" {
+		origins = os.Getenv("CLIENT_URL")
+	}
+	if origins == "" {
+		origins = "http://localhost:3000"
+	}
+
+	return NewWebAuthn(rpID, rpName, strings.Split(origins, ","))
+}
+
+// ключи создаются только discoverable и с проверкой пользователя: вход всегда идет без email
+func NewWebAuthn(rpID, rpName string, origins []string) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpName,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+func (s *AuthService) loadWebAuthnUser(user *models.User) (*webAuthnUser, []models.WebAuthnCredential, error) {
+	stored, err := s.userRepo.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка загрузки ключей: %w", err)
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, item := range stored {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(item.Data), &credential); err != nil {
+			return nil, nil, fmt.Errorf("ошибка чтения ключа %d: %w", item.ID, err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return &webAuthnUser{user: user, credentials: credentials}, stored, nil
+}
+
+func (s *AuthService) saveWebAuthnSession(userID *uint, operation string, data *webauthn.SessionData) (string, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации сессии: %w", err)
+	}
+
+	session := &models.WebAuthnSession{
+		UUID:      uuid.New().String(),
+		UserID:    userID,
+		Operation: operation,
+		Data:      string(payload),
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+	}
+
+	if err := s.userRepo.CreateWebAuthnSession(session); err != nil {
+		return "", fmt.Errorf("ошибка создания сессии: %w", err)
+	}
+
+	return session.UUID, nil
+}
+
+// забирает сессию церемонии, сессия одноразовая и удаляется сразу
+func (s *AuthService) takeWebAuthnSession(sessionID, operation string) (*models.WebAuthnSession, *webauthn.SessionData, error) {
+	session, err := s.userRepo.GetValidWebAuthnSession(sessionID, operation)
+	if err != nil {
+		return nil, nil, errors.New("сессия не найдена или истекла")
+	}
+
+	if err := s.userRepo.DeleteWebAuthnSession(sessionID); err != nil {
+		return nil, nil, fmt.Errorf("ошибка удаления сессии: %w", err)
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(session.Data), &data); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения сессии: %w", err)
+	}
+
+	return session, &data, nil
+}
+
+func (s *AuthService) BeginWebAuthnRegistration(userID uint) (*models.WebAuthnBeginResponse, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("WebAuthn не настроен")
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+
+	waUser, _, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, data, err := s.webAuthn.BeginRegistration(
+		waUser,
+		webauthn.WithExclusions(webauthn.Credentials(waUser.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала регистрации ключа: %w", err)
+	}
+
+	sessionID, err := s.saveWebAuthnSession(&user.ID, "register", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnBeginResponse{SessionID: sessionID, Options: creation}, nil
+}
+
+func (s *AuthService) FinishWebAuthnRegistration(userID uint, req *models.WebAuthnFinishRequest, client *models.ClientInfo) (*models.WebAuthnCredential, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("WebAuthn не настроен")
+	}
+
+	session, data, err := s.takeWebAuthnSession(req.SessionID, "register")
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID == nil || *session.UserID != userID {
+		return nil, errors.New("сессия не найдена или истекла")
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("пользователь не найден")
+	}
+
+	waUser, _, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		return nil, fmt.Errorf("неверный ответ аутентификатора: %w", err)
+	}
+
+	credential, err := s.webAuthn.CreateCredential(waUser, *data, parsed)
+	if err != nil {
+		err = fmt.Errorf("ключ не прошел проверку: %w", err)
+		s.recordEvent(client, "webauthn_credential_added", user.ID, err, "")
+		return nil, err
+	}
+
+	payload, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации ключа: %w", err)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Ключ доступа"
+	}
+
+	stored := &models.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Data:         string(payload),
+	}
+
+	if err := s.userRepo.CreateWebAuthnCredential(stored); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения ключа: %w", err)
+	}
+
+	s.recordEvent(client, "webauthn_credential_added", user.ID, nil, fmt.Sprintf("credential_id=%d", stored.ID))
+	return stored, nil
+}
+
+// вход по discoverable passkey, пользователь определяется по user handle. Email не спрашивается,
+// поэтому ответ одинаков для всех и не раскрывает, есть ли аккаунт и ключи у него
+func (s *AuthService) BeginWebAuthnLogin() (*models.WebAuthnBeginResponse, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("WebAuthn не настроен")
+	}
+
+	assertion, data, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала входа: %w", err)
+	}
+
+	sessionID, err := s.saveWebAuthnSession(nil, "login", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnBeginResponse{SessionID: sessionID, Options: assertion}, nil
+}
+
+func (s *AuthService) FinishWebAuthnLogin(req *models.WebAuthnFinishRequest, client *models.ClientInfo) (*models.VerifyResponse, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("WebAuthn не настроен")
+	}
+
+	_, data, err := s.takeWebAuthnSession(req.SessionID, "login")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		return nil, fmt.Errorf("неверный ответ аутентификатора: %w", err)
+	}
+
+	var waUser *webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, ok := webAuthnUserID(userHandle)
+		if !ok {
+			return nil, errors.New("неизвестный ключ")
+		}
+		user, err := s.userRepo.GetUserByID(userID)
+		if err != nil {
+			return nil, errors.New("неизвестный ключ")
+		}
+		loaded, _, err := s.loadWebAuthnUser(user)
+		if err != nil {
+			return nil, err
+		}
+		waUser = loaded
+		return loaded, nil
+	}
+
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(handler, *data, parsed)
+	if err != nil {
+		err = errors.New("ключ не прошел проверку")
+		var userID uint
+		if waUser != nil {
+			userID = waUser.user.ID
+		}
+		s.recordEvent(client, "webauthn_login", userID, err, "discoverable=true")
+		return nil, err
+	}
+
+	// СЧЕТЧИК ПОДПИСЕЙ НЕ ВЫРОС - ВОЗМОЖНО КЛОН КЛЮЧА
+	if credential.Authenticator.CloneWarning {
+		err := errors.New("ключ не прошел проверку: возможно, он был скопирован")
+		s.recordEvent(client, "webauthn_login", waUser.user.ID, err, "")
+		return nil, err
+	}
+
+	stored, err := s.userRepo.GetWebAuthnCredentialByCredentialID(credential.ID)
+	if err != nil {
+		return nil, errors.New("ключ не найден")
+	}
+
+	payload, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации ключа: %w", err)
+	}
+
+	now := time.Now()
+	stored.Data = string(payload)
+	stored.LastUsedAt = &now
+	if err := s.userRepo.UpdateWebAuthnCredential(stored); err != nil {
+		return nil, fmt.Errorf("ошибка обновления ключа: %w", err)
+	}
+
+	user := waUser.user
+	if isLocked(user) {
+		s.recordEvent(client, "webauthn_login", user.ID, ErrAccountLocked, "")
+		return nil, ErrAccountLocked
+	}
+
+	if err := checkAccountUsable(user); err != nil {
+		s.recordEvent(client, "webauthn_login", user.ID, err, "")
+		return nil, err
+	}
+
+	tokens, err := s.generateTokens(user, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(client, "webauthn_login", user.ID, nil, fmt.Sprintf("credential_id=%d", stored.ID))
+
+	return &models.VerifyResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		User:         publicUser(user),
+	}, nil
+}
+
+func (s *AuthService) ListWebAuthnCredentials(userID uint) ([]models.WebAuthnCredential, error) {
+	return s.userRepo.GetWebAuthnCredentialsByUserID(userID)
+}
+
+func (s *AuthService) DeleteWebAuthnCredential(userID, credentialID uint, client *models.ClientInfo) error {
+	details := fmt.Sprintf("credential_id=%d", credentialID)
+	if err := s.userRepo.DeleteWebAuthnCredential(userID, credentialID); err != nil {
+		err = errors.New("ключ не найден")
+		s.recordEvent(client, "webauthn_credential_removed", userID, err, details)
+		return err
+	}
+	s.recordEvent(client, "webauthn_credential_removed", userID, nil, details)
+	return nil
+}
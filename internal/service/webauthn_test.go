@@ -0,0 +1,347 @@
+package service
+
+import (
+	"auth-service/internal/models"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// программный аутентификатор: ES256, attestation "none", discoverable ключ с проверкой пользователя
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// флаги UP и UV, с attestedCredentialData еще AT
+func (a *softAuthenticator) authenticatorData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+func clientDataJSON(t *testing.T, ceremony, challenge []byte, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return data
+}
+
+// ответ navigator.credentials.create() на параметры регистрации
+func (a *softAuthenticator) register(t *testing.T, creation *protocol.CredentialCreation, origin string) []byte {
+	t.Helper()
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	ecdhKey, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatalf("ECDH: %v", err)
+	}
+	point := ecdhKey.Bytes()[1:]
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: point[:32],
+		YCoord: point[32:],
+	})
+	if err != nil {
+		t.Fatalf("Marshal COSE key: %v", err)
+	}
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(creation.Response.RelyingParty.ID, 0x45, attested),
+	})
+	if err != nil {
+		t.Fatalf("Marshal attestation: %v", err)
+	}
+
+	return a.credentialJSON(t, map[string]string{
+		"clientDataJSON":    b64(clientDataJSON(t, []byte(protocol.CreateCeremony), creation.Response.Challenge, origin)),
+		"attestationObject": b64(attestationObject),
+	})
+}
+
+// ответ navigator.credentials.get(), подпись над authenticatorData || sha256(clientDataJSON)
+func (a *softAuthenticator) login(t *testing.T, challenge []byte, rpID, origin string) []byte {
+	t.Helper()
+	a.counter++
+
+	authData := a.authenticatorData(rpID, 0x05, nil)
+	clientData := clientDataJSON(t, []byte(protocol.AssertCeremony), challenge, origin)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1: %v", err)
+	}
+
+	return a.credentialJSON(t, map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credentialJSON(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return data
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// сессия церемонии проходит через базу в JSON, как в saveWebAuthnSession и takeWebAuthnSession
+func roundTripSession(t *testing.T, data *webauthn.SessionData) webauthn.SessionData {
+	t.Helper()
+	payload, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Marshal session: %v", err)
+	}
+	var restored webauthn.SessionData
+	if err := json.Unmarshal(payload, &restored); err != nil {
+		t.Fatalf("Unmarshal session: %v", err)
+	}
+	return restored
+}
+
+// регистрирует ключ так же, как BeginWebAuthnRegistration и FinishWebAuthnRegistration
+func registerSoftAuthenticator(t *testing.T, wa *webauthn.WebAuthn, user *webAuthnUser) *softAuthenticator {
+	t.Helper()
+	authenticator := newSoftAuthenticator(t)
+
+	creation, data, err := wa.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()))
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(authenticator.register(t, creation, testOrigin))
+	if err != nil {
+		t.Fatalf("ParseCredentialCreationResponseBytes: %v", err)
+	}
+	credential, err := wa.CreateCredential(user, roundTripSession(t, data), parsed)
+	if err != nil {
+		t.Fatalf("CreateCredential: %v", err)
+	}
+
+	// ключ хранится в базе в JSON
+	payload, err := json.Marshal(credential)
+	if err != nil {
+		t.Fatalf("Marshal credential: %v", err)
+	}
+	var stored webauthn.Credential
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		t.Fatalf("Unmarshal credential: %v", err)
+	}
+	user.credentials = append(user.credentials, stored)
+	return authenticator
+}
+
+func newTestWebAuthn(t *testing.T) *webauthn.WebAuthn {
+	t.Helper()
+	wa, err := NewWebAuthn(testRPID, "Auth Service", []string{testOrigin})
+	if err != nil {
+		t.Fatalf("NewWebAuthn: %v", err)
+	}
+	return wa
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	wa := newTestWebAuthn(t)
+	user := &webAuthnUser{user: &models.User{ID: 42, Email: "user@example.com", Name: "Иван", Lastname: "Петров"}}
+
+	tests := []struct {
+		name    string
+		origin  string
+		wantErr bool
+	}{
+		{"разрешенный origin", testOrigin, false},
+		{"чужой origin", "https://evil.example", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creation, data, err := wa.BeginRegistration(user)
+			if err != nil {
+				t.Fatalf("BeginRegistration: %v", err)
+			}
+			if creation.Response.AuthenticatorSelection.ResidentKey != protocol.ResidentKeyRequirementRequired {
+				t.Fatalf("ключ должен быть discoverable, получили %q", creation.Response.AuthenticatorSelection.ResidentKey)
+			}
+
+			parsed, err := protocol.ParseCredentialCreationResponseBytes(newSoftAuthenticator(t).register(t, creation, tt.origin))
+			if err != nil {
+				t.Fatalf("ParseCredentialCreationResponseBytes: %v", err)
+			}
+			_, err = wa.CreateCredential(user, roundTripSession(t, data), parsed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateCredential: err = %v, ожидали ошибку: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	wa := newTestWebAuthn(t)
+	user := &webAuthnUser{user: &models.User{ID: 42, Email: "user@example.com"}}
+	authenticator := registerSoftAuthenticator(t, wa, user)
+
+	// так FinishWebAuthnLogin находит пользователя по user handle
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, ok := webAuthnUserID(userHandle)
+		if !ok || userID != user.user.ID {
+			return nil, errors.New("неизвестный ключ")
+		}
+		return user, nil
+	}
+
+	tests := []struct {
+		name          string
+		prepare       func(a *softAuthenticator, challenge []byte) []byte
+		wantErr       bool
+		wantCloneWarn bool
+	}{
+		{
+			name: "подпись зарегистрированным ключом",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				return a.login(t, challenge, testRPID, testOrigin)
+			},
+		},
+		{
+			name: "challenge другой сессии",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				return a.login(t, []byte("другой challenge другой сессии!!"), testRPID, testOrigin)
+			},
+			wantErr: true,
+		},
+		{
+			name: "чужой origin",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				return a.login(t, challenge, testRPID, "https://evil.example")
+			},
+			wantErr: true,
+		},
+		{
+			name: "чужой RP ID",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				return a.login(t, challenge, "evil.example", testOrigin)
+			},
+			wantErr: true,
+		},
+		{
+			name: "неизвестный user handle",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				handle := a.userHandle
+				a.userHandle = webAuthnUserHandle(7)
+				defer func() { a.userHandle = handle }()
+				return a.login(t, challenge, testRPID, testOrigin)
+			},
+			wantErr: true,
+		},
+		{
+			name: "другой ключ с тем же credential id",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				impostor := newSoftAuthenticator(t)
+				impostor.credentialID, impostor.userHandle, impostor.counter = a.credentialID, a.userHandle, a.counter
+				return impostor.login(t, challenge, testRPID, testOrigin)
+			},
+			wantErr: true,
+		},
+		{
+			name: "счетчик подписей не вырос",
+			prepare: func(a *softAuthenticator, challenge []byte) []byte {
+				a.counter = 0
+				return a.login(t, challenge, testRPID, testOrigin)
+			},
+			wantCloneWarn: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertion, data, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+			if err != nil {
+				t.Fatalf("BeginDiscoverableLogin: %v", err)
+			}
+			if len(assertion.Response.AllowedCredentials) != 0 {
+				t.Fatal("параметры входа не должны перечислять ключи аккаунта")
+			}
+
+			parsed, err := protocol.ParseCredentialRequestResponseBytes(tt.prepare(authenticator, assertion.Response.Challenge))
+			if err != nil {
+				t.Fatalf("ParseCredentialRequestResponseBytes: %v", err)
+			}
+
+			_, credential, err := wa.ValidatePasskeyLogin(handler, roundTripSession(t, data), parsed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidatePasskeyLogin: err = %v, ожидали ошибку: %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if credential.Authenticator.CloneWarning != tt.wantCloneWarn {
+				t.Fatalf("CloneWarning = %t, ожидали %t", credential.Authenticator.CloneWarning, tt.wantCloneWarn)
+			}
+			user.credentials[0] = *credential
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// тело письма в email_outbox содержит коды и ссылки, пока письмо ждет отправки. В базе оно
+// шифруется AES-256-GCM ключом из EMAIL_ENCRYPTION_KEY, получатель - связанные данные
+const emailBodyPrefix = "enc:v1:"
+
+// проверка при запуске, как для TOTP_ENCRYPTION_KEY
+func CheckEmailEncryptionKey() error {
+	if os.Getenv("EMAIL_ENCRYPTION_KEY") == "" {
+		return errors.New("EMAIL_ENCRYPTION_KEY не задан")
+	}
+	return nil
+}
+
+// пустое тело (письмо без текстовой версии) остается пустым
+func EncryptEmailBody(recipient, body string) (string, error) {
+	if body == "" {
+		return "", nil
+	}
+	sealed, err := sealSecret("EMAIL_ENCRYPTION_KEY", []byte(body), emailBodyAdditionalData(recipient))
+	if err != nil {
+		return "", err
+	}
+	return emailBodyPrefix + sealed, nil
+}
+
+// тело без префикса поставлено в очередь до шифрования и возвращается как есть
+func DecryptEmailBody(recipient, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, emailBodyPrefix)
+	if !ok {
+		return stored, nil
+	}
+
+	body, err := openSecret("EMAIL_ENCRYPTION_KEY", encoded, emailBodyAdditionalData(recipient), "email body")
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func emailBodyAdditionalData(recipient string) []byte {
+	return []byte("to:" + strings.ToLower(recipient))
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailBodyEncryption(t *testing.T) {
+	t.Setenv("EMAIL_ENCRYPTION_KEY", "test-key")
+	body := "Ваш код: 123456"
+	encrypted, err := EncryptEmailBody("user@example.com", body)
+	if err != nil {
+		t.Fatalf("EncryptEmailBody: %v", err)
+	}
+	if !strings.HasPrefix(encrypted, emailBodyPrefix) || strings.Contains(encrypted, "123456") {
+		t.Fatalf("тело не зашифровано: %s", encrypted)
+	}
+	if empty, err := EncryptEmailBody("user@example.com", ""); err != nil || empty != "" {
+		t.Fatalf("пустое тело = %q, %v", empty, err)
+	}
+
+	tests := []struct {
+		name      string
+		recipient string
+		stored    string
+		key       string
+		want      string
+		wantErr   bool
+	}{
+		{"зашифрованное тело", "user@example.com", encrypted, "test-key", body, false},
+		{"регистр адреса не важен", "User@Example.com", encrypted, "test-key", body, false},
+		{"тело чужого письма", "other@example.com", encrypted, "test-key", "", true},
+		{"другой ключ", "user@example.com", encrypted, "other-key", "", true},
+		{"поставлено в очередь до шифрования", "user@example.com", body, "test-key", body, false},
+		{"испорченное значение", "user@example.com", emailBodyPrefix + "!!!", "test-key", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EMAIL_ENCRYPTION_KEY", tt.key)
+			got, err := DecryptEmailBody(tt.recipient, tt.stored)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("DecryptEmailBody = %q, %v", got, err)
+			}
+		})
+	}
+}
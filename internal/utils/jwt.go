@@ -3,8 +3,10 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -27,40 +29,111 @@ func GetTokenExpiration() (accessExp time.Duration, refreshExp time.Duration) {
 		time.Duration(refreshDays) * 24 * time.Hour
 }
 
-// возвращает JWT из env
+// возвращает JWT из env, пусто если секрет не задан
 func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return []byte("fallback-secret-key-change-in-production")
-	}
-	return []byte(secret)
+	return []byte(os.Getenv("JWT_SECRET"))
 }
 
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID       uint     `json:"user_id"`
+	Email        string   `json:"email,omitempty"` // в токенах приложений только со scope email
+	Roles        []string `json:"roles,omitempty"`
+	Permissions  []string `json:"perms,omitempty"`    // права всех ролей, при их изменении токены перевыпускаются
+	SessionID    string   `json:"sid,omitempty"`      // цепочка refresh токенов, из которой выдан токен
+	TokenVersion int      `json:"ver"`                // версия токенов пользователя на момент выдачи
+	ClientID     string   `json:"azp,omitempty"`      // приложение OAuth, которому выдан токен
+	Scope        string   `json:"scope,omitempty"`    // scope, разрешенный приложению, через пробел
+	SubjectType  string   `json:"sub_type,omitempty"` // SubjectUser или SubjectService
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, email, role string) (string, error) {
+// кому выдан access token: пользователю или сервису по client credentials (sub - client_id)
+const (
+	SubjectUser    = "user"
+	SubjectService = "service"
+)
+
+// токены без sub_type выданы версиями до client credentials, это всегда пользователи
+func (c *Claims) SubjectKind() string {
+	if c.SubjectType == "" {
+		return SubjectUser
+	}
+	return c.SubjectType
+}
+
+func (c *Claims) IsService() bool {
+	return c.SubjectType == SubjectService
+}
+
+// iss всех токенов сервиса. Для OpenID Connect это публичный адрес сервиса из OIDC_ISSUER
+func Issuer() string {
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		return strings.TrimSuffix(issuer, "/")
+	}
+	return "auth-service"
+}
+
+// aud токенов самого сервиса: JWT_AUDIENCE, по умолчанию issuer. Приложениям OAuth не выдается
+func FirstPartyAudience() string {
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return Issuer()
+}
+
+// подписывает access token, срок жизни, время выдачи, issuer и subject проставляются здесь.
+// sub - заранее заданный claims.Subject, без него email
+func GenerateToken(claims *Claims) (string, error) {
 	accessExp, _ := GetTokenExpiration()
-	expirationTime := time.Now().Add(accessExp)
+	return GenerateTokenWithTTL(claims, accessExp, nil)
+}
+
+// access token со своим сроком жизни и aud, без aud - токен самого сервиса
+func GenerateTokenWithTTL(claims *Claims, ttl time.Duration, audience []string) (string, error) {
+	now := time.Now()
+	if len(audience) == 0 {
+		audience = []string{FirstPartyAudience()}
+	}
+
+	subject := claims.Subject
+	if subject == "" {
+		subject = claims.Email
+	}
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		Subject:   subject,
+		Issuer:    Issuer(),
+		Audience:  audience,
+	}
 
+	return signWithActiveKey(claims)
+}
+
+// access token сервиса: без пользователя, сессии и ролей, права задаются только scope
+func GenerateServiceToken(clientID, scope string, audience []string, ttl time.Duration) (string, error) {
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		ClientID:    clientID,
+		Scope:       scope,
+		SubjectType: SubjectService,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   email,
-			Issuer:    "auth-service",
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   clientID,
+			Issuer:    Issuer(),
+			Audience:  audience,
 		},
 	}
+	return signWithActiveKey(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(getJWTSecret())
+func signWithActiveKey(claims jwt.Claims) (string, error) {
+	key := CurrentKeyRing().Active()
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey())
 }
 
 func GenerateRefreshToken() (string, error) {
@@ -74,10 +147,20 @@ func GenerateRefreshToken() (string, error) {
 
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
+	ring := CurrentKeyRing()
 
+	// ключ выбираем по kid, алгоритм токена обязан совпадать с алгоритмом ключа
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return getJWTSecret(), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ring.lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+		}
+		return key.verifyKey(), nil
+	}, jwt.WithValidMethods(ring.algorithms()))
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,366 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ключ подписи токенов, для HS256 заполнен только Secret
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Secret    []byte
+}
+
+func (k *SigningKey) signingMethod() jwt.SigningMethod {
+	switch k.Algorithm {
+	case "RS256":
+		return jwt.SigningMethodRS256
+	case "ES256":
+		return jwt.SigningMethodES256
+	case "EdDSA":
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+func (k *SigningKey) signKey() interface{} {
+	if k.Algorithm == "HS256" {
+		return k.Secret
+	}
+	return k.Private
+}
+
+func (k *SigningKey) verifyKey() interface{} {
+	if k.Algorithm == "HS256" {
+		return k.Secret
+	}
+	return k.Private.Public()
+}
+
+// набор ключей: активным подписываем, остальные только для проверки
+type KeyRing struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeyRing(active *SigningKey, verifyOnly ...*SigningKey) *KeyRing {
+	ring := &KeyRing{active: active, keys: map[string]*SigningKey{}}
+	for _, key := range append([]*SigningKey{active}, verifyOnly...) {
+		if key == nil {
+			continue
+		}
+		ring.keys[key.ID] = key
+	}
+	return ring
+}
+
+func (r *KeyRing) Active() *SigningKey {
+	return r.active
+}
+
+// ТОКЕН БЕЗ kid НЕ ПРИНИМАЕТСЯ НИКАКИМ КЛЮЧОМ: ТАК ПОДПИСЫВАЛИСЬ ТОКЕНЫ ДО НАБОРА КЛЮЧЕЙ,
+// В НИХ НЕТ sid И aud, И ИХ ВСЕ РАВНО ОТКЛОНИЛИ БЫ CheckAccessToken И RequireFirstParty
+func (r *KeyRing) lookup(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		return nil, false
+	}
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+func (r *KeyRing) algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range r.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	return algs
+}
+
+var (
+	keyRing     atomic.Pointer[KeyRing]
+	keyRingOnce sync.Once
+)
+
+func SetKeyRing(ring *KeyRing) {
+	keyRing.Store(ring)
+}
+
+// возвращает текущий набор ключей, при первом обращении читает его из env
+func CurrentKeyRing() *KeyRing {
+	keyRingOnce.Do(func() {
+		if keyRing.Load() != nil {
+			return
+		}
+		key, err := LoadSigningKeyFromEnv()
+		if err != nil {
+			log.Fatalf("❌ Ошибка загрузки ключа подписи JWT: %v", err)
+		}
+		keyRing.CompareAndSwap(nil, NewKeyRing(key))
+	})
+	return keyRing.Load()
+}
+
+// JWT_SIGNING_ALG: HS256 (по умолчанию, секрет JWT_SECRET), RS256, ES256 или EdDSA
+// с приватным ключом из JWT_PRIVATE_KEY_FILE в PEM
+func LoadSigningKeyFromEnv() (*SigningKey, error) {
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = "HS256"
+	}
+
+	if alg == "HS256" {
+		if legacy := LegacySigningKeyFromEnv(); legacy != nil {
+			return legacy, nil
+		}
+		return nil, errors.New("JWT_SECRET не задан")
+	}
+
+	keyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	if keyFile == "" {
+		log.Printf("⚠️ JWT_PRIVATE_KEY_FILE не задан, генерируем временный ключ %s - токены не переживут перезапуск", alg)
+		return GenerateSigningKey(alg)
+	}
+
+	return LoadSigningKeyFile(alg, keyFile)
+}
+
+func LoadSigningKeyFile(alg, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	return ParseSigningKeyPEM(alg, data)
+}
+
+// ключ из JWT_SECRET для JWT_SIGNING_ALG=HS256 без набора ключей в базе
+func LegacySigningKeyFromEnv() *SigningKey {
+	secret := getJWTSecret()
+	if len(secret) == 0 {
+		return nil
+	}
+	return NewHMACSigningKey(secret)
+}
+
+func NewHMACSigningKey(secret []byte) *SigningKey {
+	sum := sha256.Sum256(secret)
+	return &SigningKey{
+		ID:        "hs256-" + hex.EncodeToString(sum[:4]),
+		Algorithm: "HS256",
+		Secret:    secret,
+	}
+}
+
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+
+	return newAsymmetricSigningKey(alg, private)
+}
+
+func ParseSigningKeyPEM(alg string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+
+	return newAsymmetricSigningKey(alg, private)
+}
+
+func EncodeSigningKeyPEM(key *SigningKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func newAsymmetricSigningKey(alg string, private crypto.Signer) (*SigningKey, error) {
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		if alg != "RS256" {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", alg)
+		}
+	case *ecdsa.PrivateKey:
+		if alg != "ES256" || p.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ECDSA key must be P-256 and used with ES256, got %s", alg)
+		}
+	case ed25519.PrivateKey:
+		if alg != "EdDSA" {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", alg)
+		}
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+
+	key := &SigningKey{Algorithm: alg, Private: private}
+	jwk, err := key.publicJWK()
+	if err != nil {
+		return nil, err
+	}
+
+	thumbprint, err := jwk.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint
+
+	return key, nil
+}
+
+// публичная часть ключа в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *SigningKey) publicJWK() (*JWK, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	switch public := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   b64(public.N.Bytes()),
+			E:   b64(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		ecdhKey, err := public.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode EC key: %w", err)
+		}
+		// несжатая точка: 0x04 || X || Y
+		raw := ecdhKey.Bytes()[1:]
+		size := len(raw) / 2
+		return &JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64(raw[:size]),
+			Y:   b64(raw[size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64(public),
+		}, nil
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+}
+
+// RFC 7638: sha256 от обязательных полей в лексикографическом порядке
+func (j *JWK) thumbprint() (string, error) {
+	var members []string
+	switch j.Kty {
+	case "RSA":
+		members = []string{`"e":` + quote(j.E), `"kty":"RSA"`, `"n":` + quote(j.N)}
+	case "EC":
+		members = []string{`"crv":` + quote(j.Crv), `"kty":"EC"`, `"x":` + quote(j.X), `"y":` + quote(j.Y)}
+	case "OKP":
+		members = []string{`"crv":` + quote(j.Crv), `"kty":"OKP"`, `"x":` + quote(j.X)}
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", j.Kty)
+	}
+
+	sum := sha256.Sum256([]byte("{" + strings.Join(members, ",") + "}"))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// публичные ключи для /.well-known/jwks.json, HS256 ключи не публикуются
+func (r *KeyRing) JWKS() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range r.keys {
+		if key.Algorithm == "HS256" {
+			continue
+		}
+		jwk, err := key.publicJWK()
+		if err != nil {
+			log.Printf("⚠️ Не удалось опубликовать ключ %s: %v", key.ID, err)
+			continue
+		}
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Algorithm
+		set.Keys = append(set.Keys, *jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func mustGenerateKey(t *testing.T, alg string) *SigningKey {
+	t.Helper()
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey(%s): %v", alg, err)
+	}
+	return key
+}
+
+func TestKeyRingLookup(t *testing.T) {
+	active := mustGenerateKey(t, "ES256")
+	verifyOnly := mustGenerateKey(t, "EdDSA")
+	legacy := NewHMACSigningKey([]byte("legacy-secret"))
+
+	tests := []struct {
+		name string
+		ring *KeyRing
+		kid  string
+		want *SigningKey
+	}{
+		{"активный ключ", NewKeyRing(active, verifyOnly), active.ID, active},
+		{"ключ только для проверки", NewKeyRing(active, verifyOnly), verifyOnly.ID, verifyOnly},
+		{"неизвестный kid", NewKeyRing(active, verifyOnly), "unknown", nil},
+		{"без kid", NewKeyRing(active, verifyOnly), "", nil},
+		{"HS256 ключ в наборе не открывает токены без kid", NewKeyRing(active, legacy), "", nil},
+		{"HS256 ключ с kid", NewKeyRing(legacy), legacy.ID, legacy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.ring.lookup(tt.kid)
+			if ok != (tt.want != nil) || got != tt.want {
+				t.Fatalf("lookup(%q) = %v, %t, ожидали %v", tt.kid, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := mustGenerateKey(t, "ES256")
+	newKey := mustGenerateKey(t, "RS256")
+
+	SetKeyRing(NewKeyRing(oldKey))
+	oldToken, err := GenerateToken(&Claims{UserID: 1, Email: "user@example.com"})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	// новый ключ активирован, старый оставлен для проверки
+	SetKeyRing(NewKeyRing(newKey, oldKey))
+	newToken, err := GenerateToken(&Claims{UserID: 1, Email: "user@example.com"})
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		ring   *KeyRing
+		token  string
+		wantOK bool
+	}{
+		{"старый токен во время ротации", NewKeyRing(newKey, oldKey), oldToken, true},
+		{"новый токен во время ротации", NewKeyRing(newKey, oldKey), newToken, true},
+		{"старый токен после вывода ключа", NewKeyRing(newKey), oldToken, false},
+		{"новый токен после вывода старого ключа", NewKeyRing(newKey), newToken, true},
+		{"новый токен до публикации ключа", NewKeyRing(oldKey), newToken, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetKeyRing(tt.ring)
+			claims, err := ValidateToken(tt.token)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("ValidateToken: err = %v, ожидали успех: %t", err, tt.wantOK)
+			}
+			if err == nil && claims.UserID != 1 {
+				t.Fatalf("user_id = %d, ожидали 1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestValidateTokenWithoutKid(t *testing.T) {
+	active := mustGenerateKey(t, "ES256")
+	legacy := NewHMACSigningKey([]byte("legacy-secret"))
+
+	// так подписывались токены до появления набора ключей
+	claims := &Claims{UserID: 1, Email: "user@example.com", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(legacy.Secret)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ring *KeyRing
+	}{
+		{"ключ JWT_SECRET только для проверки", NewKeyRing(active, legacy)},
+		{"ключ JWT_SECRET активный", NewKeyRing(legacy)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetKeyRing(tt.ring)
+			if _, err := ValidateToken(token); err == nil {
+				t.Fatalf("ValidateToken принял токен без kid")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ID token OpenID Connect. Профиль и email попадают в токен только при соответствующих scope
+type IDTokenClaims struct {
+	Nonce           string `json:"nonce,omitempty"`
+	AuthTime        int64  `json:"auth_time,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	Email           string `json:"email,omitempty"`
+	EmailVerified   *bool  `json:"email_verified,omitempty"`
+	Name            string `json:"name,omitempty"`
+	GivenName       string `json:"given_name,omitempty"`
+	FamilyName      string `json:"family_name,omitempty"`
+	Locale          string `json:"locale,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// подписывает ID token для приложения clientID, живет столько же, сколько access token
+func GenerateIDToken(claims *IDTokenClaims, subject, clientID string) (string, error) {
+	accessExp, _ := GetTokenExpiration()
+	now := time.Now()
+
+	claims.AuthorizedParty = clientID
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    Issuer(),
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{clientID},
+		ExpiresAt: jwt.NewNumericDate(now.Add(accessExp)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	return signWithActiveKey(claims)
+}
+
+// проверка PKCE по RFC 7636, поддерживается только S256
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// алгоритм подписи ID token для discovery
+func SigningAlgorithm() string {
+	return CurrentKeyRing().Active().Algorithm
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	challengeOf := func(verifier string) string {
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	verifier := strings.Repeat("a", 43)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"верный verifier", verifier, challengeOf(verifier), true},
+		{"максимальная длина", strings.Repeat("b", 128), challengeOf(strings.Repeat("b", 128)), true},
+		{"чужой verifier", strings.Repeat("c", 43), challengeOf(verifier), false},
+		{"challenge равен verifier (plain)", verifier, verifier, false},
+		{"challenge с дополнением base64", verifier, challengeOf(verifier) + "=", false},
+		{"пустой challenge", verifier, "", false},
+		{"короткий verifier", strings.Repeat("a", 42), challengeOf(strings.Repeat("a", 42)), false},
+		{"длинный verifier", strings.Repeat("a", 129), challengeOf(strings.Repeat("a", 129)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyCodeChallenge(tt.verifier, tt.challenge); got != tt.want {
+				t.Fatalf("VerifyCodeChallenge = %t, ожидали %t", got, tt.want)
+			}
+		})
+	}
+}
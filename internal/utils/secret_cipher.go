@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// секреты, которые нельзя хешировать (TOTP, приватные ключи подписи), шифруются AES-256-GCM
+// ключом sha256 от значения переменной keyEnv. Результат - base64(nonce || шифротекст),
+// связанные данные не дают перенести значение в чужую строку
+func secretCipher(keyEnv string) (cipher.AEAD, error) {
+	value := os.Getenv(keyEnv)
+	if value == "" {
+		return nil, errors.New(keyEnv + " не задан")
+	}
+	key := sha256.Sum256([]byte(value))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealSecret(keyEnv string, plaintext, additionalData []byte) (string, error) {
+	aead, err := secretCipher(keyEnv)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// what - что расшифровываем, для текста ошибки
+func openSecret(keyEnv, encoded string, additionalData []byte, what string) ([]byte, error) {
+	aead, err := secretCipher(keyEnv)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted %s", what)
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", what, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// приватный ключ подписи в signing_keys.private_key хранится зашифрованным, как секрет TOTP:
+// AES-256-GCM ключом из JWT_KEY_ENCRYPTION_KEY, kid - связанные данные
+const signingKeyPrefix = "enc:v1:"
+
+// проверка при запуске, как для TOTP_ENCRYPTION_KEY
+func CheckSigningKeyEncryptionKey() error {
+	if os.Getenv("JWT_KEY_ENCRYPTION_KEY") == "" {
+		return errors.New("JWT_KEY_ENCRYPTION_KEY не задан")
+	}
+	return nil
+}
+
+func EncryptSigningKeyPEM(kid string, privatePEM []byte) (string, error) {
+	sealed, err := sealSecret("JWT_KEY_ENCRYPTION_KEY", privatePEM, signingKeyAdditionalData(kid))
+	if err != nil {
+		return "", err
+	}
+	return signingKeyPrefix + sealed, nil
+}
+
+// значение без префикса - PEM, сохраненный до шифрования, возвращается как есть.
+// Такие ключи шифрует authctl secrets encrypt-signing-keys
+func DecryptSigningKeyPEM(kid, stored string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(stored, signingKeyPrefix)
+	if !ok {
+		return []byte(stored), nil
+	}
+	return openSecret("JWT_KEY_ENCRYPTION_KEY", encoded, signingKeyAdditionalData(kid), "signing key")
+}
+
+func IsSigningKeyEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, signingKeyPrefix)
+}
+
+func signingKeyAdditionalData(kid string) []byte {
+	return []byte("kid:" + kid)
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSigningKeyEncryption(t *testing.T) {
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "test-key")
+	key := mustGenerateKey(t, "ES256")
+	privatePEM, err := EncodeSigningKeyPEM(key)
+	if err != nil {
+		t.Fatalf("EncodeSigningKeyPEM: %v", err)
+	}
+	encrypted, err := EncryptSigningKeyPEM(key.ID, privatePEM)
+	if err != nil {
+		t.Fatalf("EncryptSigningKeyPEM: %v", err)
+	}
+	if !IsSigningKeyEncrypted(encrypted) || bytes.Contains([]byte(encrypted), []byte("PRIVATE KEY")) {
+		t.Fatalf("ключ не зашифрован: %s", encrypted)
+	}
+
+	tests := []struct {
+		name    string
+		kid     string
+		stored  string
+		key     string
+		want    []byte
+		wantErr bool
+	}{
+		{"зашифрованный ключ", key.ID, encrypted, "test-key", privatePEM, false},
+		{"ключ под чужим kid", "other-kid", encrypted, "test-key", nil, true},
+		{"другой ключ шифрования", key.ID, encrypted, "other-key", nil, true},
+		{"сохранен до шифрования", key.ID, string(privatePEM), "test-key", privatePEM, false},
+		{"испорченное значение", key.ID, signingKeyPrefix + "!!!", "test-key", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_KEY_ENCRYPTION_KEY", tt.key)
+			got, err := DecryptSigningKeyPEM(tt.kid, tt.stored)
+			if (err != nil) != tt.wantErr || !bytes.Equal(got, tt.want) {
+				t.Fatalf("DecryptSigningKeyPEM = %q, %v", got, err)
+			}
+		})
+	}
+
+	parsed, err := ParseSigningKeyPEM(key.Algorithm, privatePEM)
+	if err != nil || parsed.ID != key.ID {
+		t.Fatalf("расшифрованный ключ не совпадает: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+)
+
+// проверка при запуске: без ключа хеши коротких кодов подбираются перебором
+func CheckTokenHashKey() error {
+	if os.Getenv("TOKEN_HASH_KEY") == "" {
+		return errors.New("TOKEN_HASH_KEY не задан")
+	}
+	return nil
+}
+
+// ключ HMAC для refresh токенов, токенов сброса и кодов подтверждения
+func getTokenHashKey() []byte {
+	key := os.Getenv("TOKEN_HASH_KEY")
+	if key == "" {
+		log.Fatal("❌ TOKEN_HASH_KEY не задан, секреты нельзя хешировать")
+	}
+	return []byte(key)
+}
+
+// возвращает хеш секрета для хранения в базе, в открытом виде секреты не сохраняются
+func HashToken(value string) string {
+	mac := hmac.New(sha256.New, getTokenHashKey())
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
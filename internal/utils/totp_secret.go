@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// секрет TOTP нельзя хешировать как токены: по нему считаются коды. Поэтому в базе он
+// шифруется AES-256-GCM ключом из TOTP_ENCRYPTION_KEY, id пользователя - связанные данные,
+// чтобы зашифрованный секрет нельзя было перенести в чужую строку
+const totpSecretPrefix = "enc:v1:"
+
+// проверка при запуске, как для TOKEN_HASH_KEY
+func CheckTOTPEncryptionKey() error {
+	if os.Getenv("TOTP_ENCRYPTION_KEY") == "" {
+		return errors.New("TOTP_ENCRYPTION_KEY не задан")
+	}
+	return nil
+}
+
+func EncryptTOTPSecret(userID uint, secret string) (string, error) {
+	sealed, err := sealSecret("TOTP_ENCRYPTION_KEY", []byte(secret), totpAdditionalData(userID))
+	if err != nil {
+		return "", err
+	}
+	return totpSecretPrefix + sealed, nil
+}
+
+// значение без префикса сохранено до шифрования и возвращается как есть,
+// такие секреты шифрует authctl secrets encrypt-totp
+func DecryptTOTPSecret(userID uint, stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, totpSecretPrefix)
+	if !ok {
+		return stored, nil
+	}
+
+	secret, err := openSecret("TOTP_ENCRYPTION_KEY", encoded, totpAdditionalData(userID), "TOTP secret")
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+func IsTOTPSecretEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, totpSecretPrefix)
+}
+
+func totpAdditionalData(userID uint) []byte {
+	return []byte("user:" + strconv.FormatUint(uint64(userID), 10))
+}
@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestTOTPSecretEncryption(t *testing.T) {
+	t.Setenv("TOTP_ENCRYPTION_KEY", "test-key")
+	encrypted, err := EncryptTOTPSecret(1, "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("EncryptTOTPSecret: %v", err)
+	}
+	if !IsTOTPSecretEncrypted(encrypted) {
+		t.Fatalf("секрет не зашифрован: %s", encrypted)
+	}
+
+	tests := []struct {
+		name    string
+		userID  uint
+		stored  string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"зашифрованный секрет", 1, encrypted, "test-key", "JBSWY3DPEHPK3PXP", false},
+		{"секрет другого пользователя", 2, encrypted, "test-key", "", true},
+		{"другой ключ", 1, encrypted, "other-key", "", true},
+		{"сохранен до шифрования", 1, "JBSWY3DPEHPK3PXP", "test-key", "JBSWY3DPEHPK3PXP", false},
+		{"испорченное значение", 1, totpSecretPrefix + "!!!", "test-key", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TOTP_ENCRYPTION_KEY", tt.key)
+			got, err := DecryptTOTPSecret(tt.userID, tt.stored)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("DecryptTOTPSecret = %q, %v", got, err)
+			}
+		})
+	}
+}
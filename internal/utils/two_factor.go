@@ -1,12 +1,20 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"image/png"
 	"math/big"
+	"strings"
 	"time"
 
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 )
 
@@ -21,10 +29,16 @@ func GenerateTwoFactorSecret() (string, error) {
 }
 
 func GenerateQRCode(secret, email, issuer string) (string, error) {
+	// totp.Generate ждет сырые байты секрета, а у нас он хранится в base32
+	rawSecret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      issuer,
 		AccountName: email,
-		Secret:      []byte(secret),
+		Secret:      rawSecret,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate TOTP key: %w", err)
@@ -32,8 +46,51 @@ func GenerateQRCode(secret, email, issuer string) (string, error) {
 	return key.URL(), nil
 }
 
-func ValidateTwoFactorCode(secret, code string) bool {
-	return totp.Validate(code, secret)
+// возвращает PNG с QR-кодом для otpauth ссылки в виде data URI
+func GenerateQRCodeImage(otpAuthURL string) (string, error) {
+	key, err := otp.NewKeyFromURL(otpAuthURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse otpauth URL: %w", err)
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return "", fmt.Errorf("failed to render QR code: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// период кода приложения-аутентификатора в секундах
+const totpPeriod = 30
+
+// проверяет код с допуском в один шаг в обе стороны и возвращает шаг, которому он соответствует.
+// Принимаются только шаги позже lastStep, поэтому один и тот же код не проходит дважды
+func ValidateTwoFactorCode(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	if len(code) != 6 {
+		return 0, false
+	}
+
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	current := now.Unix() / totpPeriod
+	for step := current - 1; step <= current+1; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
 }
 
 func GenerateTwoFactorCode() (string, error) {
@@ -56,3 +113,36 @@ func ValidateCustomTwoFactorCode(inputCode, storedCode string, expiresAt time.Ti
 	}
 	return inputCode == storedCode
 }
+
+// без похожих символов (0/o, 1/l/i), чтобы коды было проще переписать с бумаги
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// генерирует одноразовые коды восстановления вида xxxxx-xxxxx
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, count)
+	for i := range codes {
+		code := make([]byte, 10)
+		for j := range code {
+			num, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate random number: %w", err)
+			}
+			code[j] = recoveryCodeAlphabet[num.Int64()]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+	}
+	return codes, nil
+}
+
+// хеш кода для хранения: HMAC с TOKEN_HASH_KEY поверх прежнего sha256,
+// поэтому старые хеши дохешируются без самих кодов (authctl secrets hash-legacy)
+func HashRecoveryCode(code string) string {
+	return HashToken(LegacyRecoveryCodeHash(code))
+}
+
+// sha256 без ключа, так коды хранились до миграции 024
+func LegacyRecoveryCodeHash(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
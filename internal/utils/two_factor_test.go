@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestHashRecoveryCode(t *testing.T) {
+	t.Setenv("TOKEN_HASH_KEY", "test-key")
+	want := HashRecoveryCode("abcde-fghjk")
+
+	tests := []struct {
+		name string
+		code string
+		same bool
+	}{
+		{"тот же код", "abcde-fghjk", true},
+		{"без дефиса и в верхнем регистре", "ABCDEFGHJK", true},
+		{"с пробелом", "abcde fghjk", true},
+		{"другой код", "abcde-fghjm", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashRecoveryCode(tt.code); (got == want) != tt.same {
+				t.Fatalf("HashRecoveryCode(%q) = %s, совпадение с %s ожидалось: %t", tt.code, got, want, tt.same)
+			}
+		})
+	}
+
+	// старый хеш дохешируется ключом без самого кода
+	if HashToken(LegacyRecoveryCodeHash("abcde-fghjk")) != want {
+		t.Fatal("HashRecoveryCode должен совпадать с HashToken от прежнего хеша")
+	}
+
+	t.Setenv("TOKEN_HASH_KEY", "other-key")
+	if HashRecoveryCode("abcde-fghjk") == want {
+		t.Fatal("хеш не зависит от TOKEN_HASH_KEY")
+	}
+}
+
+func TestValidateTwoFactorCodeReplay(t *testing.T) {
+	secret, err := GenerateTwoFactorSecret()
+	if err != nil {
+		t.Fatalf("GenerateTwoFactorSecret: %v", err)
+	}
+
+	now := time.Unix(1_700_000_010, 0)
+	step := now.Unix() / totpPeriod
+	codeAt := func(offset int64) string {
+		code, err := totp.GenerateCode(secret, time.Unix((step+offset)*totpPeriod, 0))
+		if err != nil {
+			t.Fatalf("GenerateCode: %v", err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"текущий код", codeAt(0), 0, step, true},
+		{"тот же код повторно", codeAt(0), step, 0, false},
+		{"предыдущий шаг в пределах допуска", codeAt(-1), 0, step - 1, true},
+		{"предыдущий шаг после текущего", codeAt(-1), step, 0, false},
+		{"следующий шаг после текущего", codeAt(1), step, step + 1, true},
+		{"код двух шагов назад", codeAt(-2), 0, 0, false},
+		{"неверный код", "000000", 0, 0, false},
+		{"неверная длина", "12345", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTwoFactorCode(secret, tt.code, tt.lastStep, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Fatalf("ValidateTwoFactorCode = %d, %t, ожидали %d, %t", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_method VARCHAR(20) NOT NULL DEFAULT 'email';
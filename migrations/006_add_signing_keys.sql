@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id SERIAL PRIMARY KEY,
+    kid VARCHAR(100) UNIQUE NOT NULL,
+    algorithm VARCHAR(10) NOT NULL,
+    private_key TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'verify_only',
+    activated_at TIMESTAMP,
+    retired_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Активный ключ может быть только один
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signing_keys_single_active ON signing_keys(status) WHERE status = 'active';
@@ -0,0 +1,16 @@
+-- Секреты хранятся как HMAC-SHA256 (64 hex символа).
+-- Существующие значения в открытом виде хешируются приложением при старте (authctl secrets hash-legacy).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'sessions' AND column_name = 'refresh_token') THEN
+        ALTER TABLE sessions RENAME COLUMN refresh_token TO refresh_token_hash;
+    END IF;
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'reset_password_tokens' AND column_name = 'token') THEN
+        ALTER TABLE reset_password_tokens RENAME COLUMN token TO token_hash;
+    END IF;
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'verification_sessions' AND column_name = 'code') THEN
+        ALTER TABLE verification_sessions RENAME COLUMN code TO code_hash;
+    END IF;
+END $$;
+
+ALTER TABLE verification_sessions ALTER COLUMN code_hash TYPE VARCHAR(64);
@@ -0,0 +1,8 @@
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip VARCHAR(45);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS client_label VARCHAR(100);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE sessions SET last_used_at = created_at WHERE last_used_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
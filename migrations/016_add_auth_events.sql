@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS auth_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INTEGER,
+    user_id INTEGER,
+    type VARCHAR(50) NOT NULL,
+    outcome VARCHAR(10) NOT NULL,
+    ip VARCHAR(45),
+    user_agent VARCHAR(512),
+    correlation_id VARCHAR(64),
+    details TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Без внешних ключей: журнал переживает удаление пользователя
+CREATE INDEX IF NOT EXISTS idx_auth_events_user_id ON auth_events(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_auth_events_actor_id ON auth_events(actor_id, id);
+CREATE INDEX IF NOT EXISTS idx_auth_events_type ON auth_events(type, id);
+CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON auth_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_auth_events_correlation_id ON auth_events(correlation_id);
+
+-- Журнал только дополняется
+CREATE OR REPLACE FUNCTION auth_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'auth_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS auth_events_no_modify ON auth_events;
+CREATE TRIGGER auth_events_no_modify BEFORE UPDATE OR DELETE ON auth_events
+    FOR EACH ROW EXECUTE FUNCTION auth_events_append_only();
+
+DROP TRIGGER IF EXISTS auth_events_no_truncate ON auth_events;
+CREATE TRIGGER auth_events_no_truncate BEFORE TRUNCATE ON auth_events
+    FOR EACH STATEMENT EXECUTE FUNCTION auth_events_append_only();
+
+-- Переносим события из security_events
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'security_events') THEN
+        INSERT INTO auth_events (actor_id, user_id, type, outcome, details, created_at)
+        SELECT user_id, user_id, type, 'failure', details, created_at
+        FROM security_events
+        ORDER BY id;
+        DROP TABLE security_events;
+    END IF;
+END $$;
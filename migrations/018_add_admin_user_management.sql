@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'Просмотр пользователей и их сессий'),
+    ('users:write', 'Изменение, отключение и сброс пользователей')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name IN ('users:read', 'users:write')
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+-- Администраторы получают новые права при следующем refresh
+UPDATE users SET token_version = token_version + 1
+WHERE id IN (SELECT ur.user_id FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE r.name = 'admin');
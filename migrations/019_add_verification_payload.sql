@@ -0,0 +1,2 @@
+-- Новый email при смене адреса и прежний email для ссылки отмены
+ALTER TABLE verification_sessions ADD COLUMN IF NOT EXISTS payload VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS oauth_authorizations (
+    id SERIAL PRIMARY KEY,
+    uuid VARCHAR(36) UNIQUE NOT NULL,
+    client_id VARCHAR(100) NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scope VARCHAR(255) NOT NULL,
+    state TEXT,
+    nonce TEXT,
+    code_challenge VARCHAR(128) NOT NULL,
+    code_challenge_method VARCHAR(10) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) UNIQUE,
+    auth_time TIMESTAMP,
+    family_id VARCHAR(36),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_authorizations_expires_at ON oauth_authorizations(expires_at);
+
+-- Сессии, выданные приложениям через /oauth/token, обновляются только этим приложением
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS client_id VARCHAR(100);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS scope VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_sessions_client_id ON sessions(client_id);
@@ -0,0 +1,30 @@
+-- Приложения OAuth, до этой миграции задавались в OIDC_CLIENTS.
+-- Списки хранятся в JSON, секрет - bcrypt-хеш (пусто у публичных клиентов)
+CREATE TABLE IF NOT EXISTS clients (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(100) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    secret_hash VARCHAR(255),
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    redirect_uris TEXT,
+    grant_types TEXT,
+    scopes TEXT,
+    audiences TEXT,
+    access_token_ttl INTEGER NOT NULL DEFAULT 0,
+    refresh_token_ttl INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('clients:manage', 'Управление приложениями OAuth')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'clients:manage'
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+-- Администраторы получают новое право при следующем refresh
+UPDATE users SET token_version = token_version + 1
+WHERE id IN (SELECT ur.user_id FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE r.name = 'admin');
@@ -0,0 +1,15 @@
+-- Явная отметка секретов, которые еще хранятся в открытом виде. authctl secrets hash-legacy
+-- хеширует только отмеченные записи и снимает отметку, длина значения больше не учитывается.
+-- Приложение пишет только хеши, поэтому у новых записей отметки нет.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS legacy_plaintext BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reset_password_tokens ADD COLUMN IF NOT EXISTS legacy_plaintext BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE verification_sessions ADD COLUMN IF NOT EXISTS legacy_plaintext BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Разовая разметка существующих строк: HMAC-SHA256 всегда 64 символа в нижнем hex,
+-- открытые refresh токены (base64), токены сброса и коды под этот формат не подходят
+UPDATE sessions SET legacy_plaintext = TRUE
+    WHERE refresh_token_hash <> '' AND refresh_token_hash !~ '^[0-9a-f]{64}$';
+UPDATE reset_password_tokens SET legacy_plaintext = TRUE
+    WHERE token_hash <> '' AND token_hash !~ '^[0-9a-f]{64}$';
+UPDATE verification_sessions SET legacy_plaintext = TRUE
+    WHERE code_hash <> '' AND code_hash !~ '^[0-9a-f]{64}$';
@@ -0,0 +1,5 @@
+-- Коды восстановления хранятся как HMAC с TOKEN_HASH_KEY поверх sha256 кода.
+-- Существующие строки остаются с keyed = FALSE, пока authctl secrets hash-legacy не наложит на них ключ,
+-- новые строки приложение пишет сразу с ключом.
+ALTER TABLE recovery_codes ADD COLUMN IF NOT EXISTS keyed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE recovery_codes ALTER COLUMN keyed SET DEFAULT TRUE;
@@ -0,0 +1,3 @@
+-- Шаг последнего принятого кода приложения-аутентификатора: код с тем же или более ранним шагом
+-- повторно не принимается, даже если еще не истек
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Раньше в details писались адреса почты (вход, сброс пароля, смена email). Журнал переживает
+-- удаление аккаунта, поэтому адреса из старых записей убираем. Это единственное изменение журнала:
+-- триггер отключается только на время миграции
+ALTER TABLE auth_events DISABLE TRIGGER auth_events_no_modify;
+
+UPDATE auth_events
+SET details = regexp_replace(details, '[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]+', '[redacted]', 'g')
+WHERE details ~ '@';
+
+ALTER TABLE auth_events ENABLE TRIGGER auth_events_no_modify;
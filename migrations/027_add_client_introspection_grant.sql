@@ -0,0 +1,3 @@
+-- Явное право приложения на интроспекцию чужих access токенов и токенов самого сервиса (шлюз).
+-- Без него приложение видит только токены, выданные ему или с его client_id в aud
+ALTER TABLE clients ADD COLUMN IF NOT EXISTS introspect_all BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+-- Ссылка отмены смены email привязывается к аккаунту: после нескольких смен подряд
+-- аккаунт по email новой сессии уже не найти
+ALTER TABLE verification_sessions ADD COLUMN IF NOT EXISTS user_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_verification_sessions_user_id ON verification_sessions(user_id);
+
+UPDATE verification_sessions vs SET user_id = u.id
+FROM users u
+WHERE vs.operation = 'email_change_undo' AND vs.user_id IS NULL AND u.email = vs.email;